@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How long TokenReview results are cached.
+const tokenReviewTTL = time.Minute
+
+// tokenReviewer validates Kubernetes bearer tokens for the control
+// endpoints, if -admin-token-review.
+type tokenReviewer struct {
+	client kubernetes.Interface
+	users  map[string]bool
+	groups map[string]bool
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenReviewResult
+}
+
+type tokenReviewResult struct {
+	user    string
+	allowed bool
+	expires time.Time
+}
+
+var reviewer *tokenReviewer
+
+func newTokenReviewer(client kubernetes.Interface, users, groups []string) *tokenReviewer {
+	r := &tokenReviewer{
+		client: client,
+		users:  make(map[string]bool),
+		groups: make(map[string]bool),
+		cache:  make(map[[sha256.Size]byte]tokenReviewResult),
+	}
+	for _, u := range users {
+		r.users[u] = true
+	}
+	for _, g := range groups {
+		r.groups[g] = true
+	}
+	return r
+}
+
+// review returns the user the token belongs to, and whether they're
+// allowed to use the control endpoints.
+func (r *tokenReviewer) review(token string) (string, bool, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.user, cached.allowed, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	tr, err := r.client.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", false, err
+	}
+	result := tokenReviewResult{
+		user:    tr.Status.User.Username,
+		allowed: tr.Status.Authenticated && r.users[tr.Status.User.Username],
+		expires: now.Add(tokenReviewTTL),
+	}
+	for _, g := range tr.Status.User.Groups {
+		if tr.Status.Authenticated && r.groups[g] {
+			result.allowed = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range r.cache {
+		if now.After(v.expires) {
+			delete(r.cache, k)
+		}
+	}
+	r.cache[key] = result
+	return result.user, result.allowed, nil
+}
+
+// controlAuthenticated wraps the control endpoints, which change what
+// we do, to require the -admin-token-file token, or a Kubernetes token
+// of an -admin-users user or -admin-groups group.  Unlike
+// authenticated(), there's no way to leave them open.
+func controlAuthenticated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := r.Header.Get("Authorization")
+		if !strings.HasPrefix(bearer, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-svc-watch"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		bearer = strings.TrimPrefix(bearer, "Bearer ")
+
+		token := cfg().adminToken
+		if token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if reviewer != nil {
+			user, allowed, err := reviewer.review(bearer)
+			if err != nil {
+				logError("Error reviewing token", "error", err)
+				http.Error(w, "Error reviewing token", http.StatusInternalServerError)
+				return
+			}
+			if allowed {
+				logInfo("Admin request", "user", user, "path", r.URL.Path, "method", r.Method)
+				h.ServeHTTP(w, r)
+				return
+			}
+			if user != "" {
+				logWarn("Admin request forbidden", "user", user, "path", r.URL.Path, "method", r.Method)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kube-svc-watch"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// amAlert is a postableAlert from the Alertmanager v2 API.
+type amAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func (a *amAlert) copy() amAlert {
+	ret := *a
+	ret.Labels = make(map[string]string, len(a.Labels))
+	for k, v := range a.Labels {
+		ret.Labels[k] = v
+	}
+	ret.Annotations = make(map[string]string, len(a.Annotations))
+	for k, v := range a.Annotations {
+		ret.Annotations[k] = v
+	}
+	return ret
+}
+
+// alertmanagerNotifier raises an alert for every detected public
+// service.  Alertmanager resolves alerts that aren't refreshed, so
+// firing alerts are re-sent every interval until the service is
+// deleted, becomes internal or is exempted.
+type alertmanagerNotifier struct {
+	url          string
+	severity     string
+	generatorURL string
+	interval     time.Duration
+
+	// stores holds each cluster's services, by cluster name.
+	stores map[string]cache.Store
+
+	mu     sync.Mutex
+	active map[string]*amAlert
+	stop   chan struct{}
+}
+
+func newAlertmanager(baseURL, severity, generatorURL string, interval time.Duration, stores map[string]cache.Store) *alertmanagerNotifier {
+	n := &alertmanagerNotifier{
+		url:          strings.TrimSuffix(baseURL, "/") + "/api/v2/alerts",
+		severity:     severity,
+		generatorURL: generatorURL,
+		interval:     interval,
+		stores:       stores,
+		active:       make(map[string]*amAlert),
+		stop:         make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Adopt takes over the active alerts of any Alertmanager notifier in
+// old, so they carry on being refreshed after a reload.  They're
+// copied, since old's run loop carries on updating its own until it's
+// closed, and any we've raised since are newer.
+func (n *alertmanagerNotifier) Adopt(old notifiers) {
+	for _, o := range old {
+		o, ok := o.(*alertmanagerNotifier)
+		if !ok {
+			continue
+		}
+		o.mu.Lock()
+		alerts := make(map[string]amAlert, len(o.active))
+		for k, v := range o.active {
+			alerts[k] = v.copy()
+		}
+		o.mu.Unlock()
+
+		n.mu.Lock()
+		for k, a := range alerts {
+			if _, ok := n.active[k]; !ok {
+				a := a
+				n.active[k] = &a
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *alertmanagerNotifier) Close() {
+	close(n.stop)
+}
+
+func (n *alertmanagerNotifier) Stateful() {}
+
+func (n *alertmanagerNotifier) Name() string {
+	return "alertmanager"
+}
+
+func (n *alertmanagerNotifier) Notify(ev *event) error {
+	key := ev.Cluster + "/" + ev.Namespace + "/" + ev.Name
+
+	n.mu.Lock()
+	alert, ok := n.active[key]
+	switch ev.Action {
+	case actionDetected:
+		if ok && ev.Repeat {
+			// Already firing, and refreshed by run.
+			n.mu.Unlock()
+			return nil
+		}
+		if !ok {
+			alert = n.newAlert(ev)
+			n.active[key] = alert
+		}
+		alert.EndsAt = time.Now().Add(3 * n.interval)
+	case actionDeleted, actionIdleDeleted:
+		if !ok {
+			alert = n.newAlert(ev)
+		}
+		alert.EndsAt = time.Now()
+		delete(n.active, key)
+	default:
+		n.mu.Unlock()
+		return nil
+	}
+	a := *alert
+	n.mu.Unlock()
+
+	return n.post([]amAlert{a})
+}
+
+func (n *alertmanagerNotifier) newAlert(ev *event) *amAlert {
+	alert := &amAlert{
+		Labels: map[string]string{
+			"alertname": "KubernetesPublicService",
+			"cluster":   ev.Cluster,
+			"namespace": ev.Namespace,
+			"service":   ev.Name,
+			"severity":  n.severity,
+		},
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("Service %s/%s is exposed by a public %s", ev.Namespace, ev.Name, ev.Type),
+		},
+		StartsAt:     ev.Time,
+		GeneratorURL: n.generatorURL,
+	}
+	if ev.Owner != "" {
+		alert.Labels["owner"] = ev.Owner
+	}
+	if len(ev.Changes) > 0 {
+		alert.Annotations["changes"] = strings.Join(ev.Changes, "\n")
+	}
+	return alert
+}
+
+func (n *alertmanagerNotifier) run() {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.stop:
+			return
+		}
+
+		n.mu.Lock()
+		alerts := make([]amAlert, 0, len(n.active))
+		for key, alert := range n.active {
+			store := n.stores[alert.Labels["cluster"]]
+			obj, exists, err := store.GetByKey(alert.Labels["namespace"] + "/" + alert.Labels["service"])
+			if err == nil && (!exists || !isViolation(obj.(*v1.Service))) {
+				alert.EndsAt = time.Now()
+				delete(n.active, key)
+			} else {
+				alert.EndsAt = time.Now().Add(3 * n.interval)
+			}
+			alerts = append(alerts, *alert)
+		}
+		n.mu.Unlock()
+
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := n.post(alerts); err != nil {
+			logError("Error refreshing alerts", "backend", "alertmanager", "error", err)
+		}
+	}
+}
+
+func (n *alertmanagerNotifier) post(alerts []amAlert) error {
+	buf, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	_, err = postJSON(n.url, "application/json", bytes.NewReader(buf), nil)
+	metrics.CountNotifications(n.Name(), len(alerts), err)
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handleAPI registers the JSON API under /api/v1/.
+func handleAPI(ls listeners, addr string, clusters []*cluster) {
+	ls.handle(addr, "/api/v1/violations", authenticated(apiHandler(func() interface{} {
+		ret := []publicService{}
+		for _, s := range publicServices(clusters) {
+			if s.Exempt == "" {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	})))
+	ls.handle(addr, "/api/v1/exemptions", authenticated(apiHandler(func() interface{} {
+		ret := []publicService{}
+		for _, s := range publicServices(clusters) {
+			if s.Exempt != "" {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	})))
+	ls.handle(addr, "/api/v1/actions", authenticated(apiHandler(func() interface{} {
+		return recent.list()
+	})))
+	ls.handle(addr, "/api/v1/costs", authenticated(apiHandler(func() interface{} {
+		return costReport(clusters)
+	})))
+	ls.handle(addr, "/api/v1/report", authenticated(reportHandler(clusters)))
+}
+
+var reportContentTypes = map[string]string{
+	"text":  "text/plain; charset=utf-8",
+	"json":  "application/json",
+	"csv":   "text/csv; charset=utf-8",
+	"html":  "text/html; charset=utf-8",
+	"sarif": "application/sarif+json",
+}
+
+// reportHandler serves the current public services as a report, in
+// the format given by the format parameter or -report-format.
+func reportHandler(clusters []*cluster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = *reportFormat
+		}
+		if _, ok := reportFormats[format]; !ok {
+			http.Error(w, fmt.Sprintf("unknown report format %q", format), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", reportContentTypes[format])
+		if err := writeReport(w, format, publicServices(clusters)); err != nil {
+			logError("Error writing report", "format", format, "error", err)
+		}
+	})
+}
+
+// apiHandler serves the result of get as JSON.
+func apiHandler(get func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(get()); err != nil {
+			logError("Error writing API response", "path", r.URL.Path, "error", err)
+		}
+	})
+}
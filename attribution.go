@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	authnv1 "k8s.io/api/authentication/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Fields whose manager is taken to be who made a service public, in
+// managedFields' notation.
+var exposingFields = [][]string{
+	{"f:spec", "f:type"},
+	{"f:metadata", "f:annotations", "f:" + detect.AWSLbInternal},
+	{"f:metadata", "f:annotations", "f:" + detect.GCPLbInternal},
+}
+
+// fieldManager returns the field manager (eg kubectl, helm) that most
+// recently set the fields that make svc public, or "" if managedFields
+// don't say.  This names the tool, not the user; see auditTrail for
+// that.
+func fieldManager(svc *v1.Service) string {
+	var manager string
+	var latest time.Time
+	for _, entry := range svc.ManagedFields {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if !hasAnyField(fields, exposingFields) {
+			continue
+		}
+		var t time.Time
+		if entry.Time != nil {
+			t = entry.Time.Time
+		}
+		if manager == "" || t.After(latest) {
+			manager, latest = entry.Manager, t
+		}
+	}
+	return manager
+}
+
+func hasAnyField(fields map[string]interface{}, paths [][]string) bool {
+	for _, path := range paths {
+		m := fields
+		found := true
+		for _, f := range path {
+			next, ok := m[f].(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			m = next
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// How long audit events are remembered.
+const auditRetention = 24 * time.Hour
+
+// The in-cluster service account token, whose subject is who we are
+// if the apiserver can't tell us.
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// audit remembers who last changed each service, from apiserver audit
+// webhook events.
+var audit = &auditTrail{
+	users: make(map[string]auditEntry),
+	self:  make(map[string]bool),
+}
+
+type auditTrail struct {
+	mu        sync.Mutex
+	users     map[string]auditEntry
+	lastSweep time.Time
+
+	// self holds cluster/username for the identities we write to
+	// each cluster as, whose changes (eg pending termination
+	// annotations) don't count.
+	self map[string]bool
+}
+
+// ignoreSelf ignores changes made by our own identities in c.
+func (a *auditTrail) ignoreSelf(c *cluster) {
+	users := selfUsernames(c)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, u := range users {
+		a.self[c.name+"/"+u] = true
+	}
+}
+
+func (a *auditTrail) isSelf(cluster, user string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.self[cluster+"/"+user]
+}
+
+// selfUsernames returns the identities we write to c as: who its
+// client authenticates as, and -as, if set.
+func selfUsernames(c *cluster) []string {
+	var users []string
+	if *impersonateUser != "" {
+		users = append(users, *impersonateUser)
+	}
+	user, err := selfUsername(c.client)
+	if err != nil {
+		logWarn("Can't tell who we are, so our own changes may be mistaken for other users'", "cluster", c.name, "error", err)
+	} else {
+		users = append(users, user)
+	}
+	return users
+}
+
+// selfUsername returns who client authenticates as, from a
+// SelfSubjectReview (Kubernetes 1.28+), or failing that the subject
+// of the in-cluster service account token.
+func selfUsername(client kubernetes.Interface) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authnv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil && review.Status.UserInfo.Username != "" {
+		return review.Status.UserInfo.Username, nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("SelfSubjectReview returned no username")
+	}
+	buf, ferr := ioutil.ReadFile(serviceAccountTokenFile)
+	if ferr != nil {
+		return "", err
+	}
+	parts := strings.Split(strings.TrimSpace(string(buf)), ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%s isn't a JWT", serviceAccountTokenFile)
+	}
+	payload, perr := base64.RawURLEncoding.DecodeString(parts[1])
+	if perr != nil {
+		return "", fmt.Errorf("%s: %s", serviceAccountTokenFile, perr)
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if perr := json.Unmarshal(payload, &claims); perr != nil || claims.Sub == "" {
+		return "", fmt.Errorf("%s has no subject", serviceAccountTokenFile)
+	}
+	return claims.Sub, nil
+}
+
+type auditEntry struct {
+	user string
+	time time.Time
+}
+
+// auditEventList is the part of an audit.k8s.io/v1 EventList we use.
+type auditEventList struct {
+	Items []struct {
+		Verb string `json:"verb"`
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		ImpersonatedUser *struct {
+			Username string `json:"username"`
+		} `json:"impersonatedUser"`
+		ObjectRef *struct {
+			Resource    string `json:"resource"`
+			Subresource string `json:"subresource"`
+			Namespace   string `json:"namespace"`
+			Name        string `json:"name"`
+		} `json:"objectRef"`
+		ResponseStatus *struct {
+			Code int `json:"code"`
+		} `json:"responseStatus"`
+		StageTimestamp time.Time `json:"stageTimestamp"`
+	} `json:"items"`
+}
+
+// lookup returns who last changed the service in cluster, if we know.
+func (a *auditTrail) lookup(cluster string, svc *v1.Service) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.users[cluster+"/"+svcKey(svc)].user
+}
+
+func (a *auditTrail) record(key, user string, t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastSweep) > auditRetention {
+		for k, e := range a.users {
+			if now.Sub(e.time) > auditRetention {
+				delete(a.users, k)
+			}
+		}
+		a.lastSweep = now
+	}
+	if old, ok := a.users[key]; !ok || !t.Before(old.time) {
+		a.users[key] = auditEntry{user, t}
+	}
+}
+
+// auditHandler receives audit events from an apiserver's webhook
+// backend.  The cluster parameter says which cluster they're from, if
+// not the first.
+func auditHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST audit events", http.StatusMethodNotAllowed)
+			return
+		}
+		cluster := r.URL.Query().Get("cluster")
+		if cluster == "" {
+			cluster = primaryCluster()
+		}
+		var list auditEventList
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, ev := range list.Items {
+			ref := ev.ObjectRef
+			if ref == nil || ref.Resource != "services" || ref.Subresource != "" {
+				continue
+			}
+			switch ev.Verb {
+			case "create", "update", "patch":
+			default:
+				continue
+			}
+			if ev.ResponseStatus != nil && ev.ResponseStatus.Code >= 300 {
+				continue
+			}
+			user := ev.User.Username
+			if ev.ImpersonatedUser != nil {
+				user = ev.ImpersonatedUser.Username
+			}
+			// Our own pending termination annotations
+			// don't count.
+			if audit.isSelf(cluster, user) {
+				continue
+			}
+			audit.record(cluster+"/"+ref.Namespace+"/"+ref.Name, user, ev.StageTimestamp)
+		}
+	})
+}
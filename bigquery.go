@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bigQueryURL = "https://bigquery.googleapis.com/bigquery/v2"
+
+	// The GCE/GKE metadata server hands out tokens for the
+	// instance's (or workload identity's) service account.
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// parseBigQueryTable returns the insertAll URL of table, named
+// project.dataset.table.
+func parseBigQueryTable(table string) (string, error) {
+	if table == "" {
+		return "", nil
+	}
+	parts := strings.Split(table, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("-bigquery-table must be project.dataset.table, got %q", table)
+	}
+	return fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll", bigQueryURL, parts[0], parts[1], parts[2]), nil
+}
+
+// newBigQuery returns a notifier that streams events into the BigQuery
+// table with the insertAll url, using the credentials of the metadata
+// server's service account.  Event fields without a column in the
+// table are ignored.
+func newBigQuery(url string) notifier {
+	tokens := &metadataToken{}
+
+	return newBatcher("bigquery", func(batch []*event) error {
+		type row struct {
+			InsertID string `json:"insertId"`
+			JSON     *event `json:"json"`
+		}
+		req := struct {
+			IgnoreUnknownValues bool  `json:"ignoreUnknownValues"`
+			Rows                []row `json:"rows"`
+		}{IgnoreUnknownValues: true}
+		for _, ev := range batch {
+			// Lets BigQuery drop rows duplicated by a retry.
+			id := fmt.Sprintf("%s/%s/%s/%d", ev.Cluster, ev.UID, ev.Action, ev.Time.UnixNano())
+			req.Rows = append(req.Rows, row{id, ev})
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		token, err := tokens.get()
+		if err != nil {
+			return err
+		}
+		resp, err := postJSON(url, "application/json", bytes.NewReader(body), func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Rejected rows are reported with a 200.
+		var result struct {
+			InsertErrors []json.RawMessage `json:"insertErrors"`
+		}
+		if err := json.Unmarshal(resp, &result); err != nil {
+			return err
+		}
+		if len(result.InsertErrors) > 0 {
+			return fmt.Errorf("%d rows rejected: %s", len(result.InsertErrors), result.InsertErrors[0])
+		}
+		return nil
+	})
+}
+
+// metadataToken caches an access token from the metadata server until
+// shortly before it expires.
+type metadataToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (t *metadataToken) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Until(t.expires) > time.Minute {
+		return t.token, nil
+	}
+
+	req, err := http.NewRequest("GET", metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	// Not httpClient, since the metadata server must not be
+	// reached through a proxy.
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("getting token from metadata server: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting token from metadata server: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	t.token = token.AccessToken
+	t.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return t.token, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nlopes/slack"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkConfig validates the configuration as far as it can without
+// starting: the settings themselves, that each cluster is reachable
+// and grants the access we need, and that the Slack token and channel
+// work.  It prints a report, and exits 1 if anything is wrong.
+func checkConfig(configPath string, _ []string) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	failed := false
+	report := func(check string, err error, detail string) {
+		result := "OK"
+		if err != nil {
+			result, detail, failed = "FAIL", err.Error(), true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result, check, detail)
+	}
+	fmt.Fprintln(w, "RESULT\tCHECK\tDETAIL")
+	defer w.Flush()
+
+	err := loadConfig(flag.CommandLine, configPath)
+	if err == nil {
+		err = applySettings()
+	}
+	report("config", err, configPath)
+	if err != nil {
+		return 1
+	}
+	// So Slack is checked through -notify-proxy, as it's used.
+	err = setupHTTPClient()
+	report("outbound http", err, *notifyProxy)
+
+	report("provider", nil, cfg().provider)
+	_, err = selectServices()
+	report("selectors", err, strings.TrimSpace(*labelSelector+" "+*fieldSelector))
+	_, err = shardFilter()
+	report("sharding", err, fmt.Sprintf("%d/%d", *shardIndex, *shardCount))
+	for _, m := range splitList(*mode) {
+		switch m {
+		case modeExporter, modeTerminator, modeWebhook:
+			report("mode", nil, m)
+		default:
+			report("mode", fmt.Errorf("unknown mode %q", m), "")
+		}
+	}
+
+	configs, err := clusterConfigs()
+	report("kubeconfig", err, *kubeconfig)
+	var names []string
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		client, err := kubernetes.NewForConfig(configs[name])
+		if err != nil {
+			report("cluster "+name, err, "")
+			continue
+		}
+		version, err := client.Discovery().ServerVersion()
+		if err != nil {
+			report("cluster "+name, err, "")
+			continue
+		}
+		report("cluster "+name, nil, "reachable, "+version.GitVersion)
+
+		deleter, err := deleteClient(configs[name], client)
+		if err != nil {
+			report("impersonation", err, "")
+			continue
+		}
+		verbs := map[string]kubernetes.Interface{"get": client, "list": client, "watch": client}
+		if cfg().terminate {
+			verbs["update"], verbs["patch"], verbs["delete"] = deleter, deleter, deleter
+		}
+		for _, verb := range []string{"get", "list", "watch", "update", "patch", "delete"} {
+			c, ok := verbs[verb]
+			if !ok {
+				continue
+			}
+			nss := []string(namespaces)
+			if len(nss) == 0 {
+				nss = []string{""}
+			}
+			for _, ns := range nss {
+				allowed, reason, err := canI(c, verb, ns)
+				if err == nil && !allowed {
+					err = fmt.Errorf("denied: %s", reason)
+				}
+				where := ns
+				if where == "" {
+					where = "all namespaces"
+				}
+				report(fmt.Sprintf("cluster %s: %s services", name, verb), err, where)
+			}
+		}
+	}
+
+	if *slackToken != "" {
+		api := slack.New(*slackToken)
+		auth, err := api.AuthTest()
+		if err != nil {
+			report("slack token", err, "")
+		} else {
+			report("slack token", nil, fmt.Sprintf("%s in %s", auth.User, auth.Team))
+			report("slack channel", checkSlackChannel(api, *slackToken, *slackChan), *slackChan)
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkSlackChannel makes sure channel, a name or ID, exists and we
+// can post to it, the same way the Slack notifier does.
+func checkSlackChannel(api *slack.Client, token, channel string) error {
+	if channel == "" {
+		return fmt.Errorf("-slack-channel is not set")
+	}
+	_, err := resolveSlackChannel(api, token, channel)
+	return err
+}
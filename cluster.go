@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Set by -context.
+var contexts stringList
+
+// cluster is one watched cluster, and the watches on it.
+type cluster struct {
+	name   string
+	client kubernetes.Interface
+
+	// deleter impersonates -as, if set, and is otherwise client.
+	deleter kubernetes.Interface
+
+	// readOnly is set when we find we're no longer allowed to
+	// delete services.
+	readOnly atomic.Bool
+	// terminating is set if the terminator runs, and enforce while
+	// -terminate is on and we're allowed to delete services.
+	terminating bool
+	enforce     atomic.Bool
+
+	// factory is for cluster-wide watches.  Services are
+	// watched per namespace if restricted to some.
+	factory   informers.SharedInformerFactory
+	factories []informers.SharedInformerFactory
+	services  []cache.SharedIndexInformer
+	store     cache.Store
+
+	// started is set once the informers have been started.
+	started atomic.Bool
+
+	// nsStore caches Namespaces for owner lookups.  It is nil
+	// until a namespace key is configured, since watching
+	// Namespaces needs additional RBAC permissions.
+	nsMu    sync.Mutex
+	nsStore cache.Store
+
+	// violations is nil unless -record-violations.
+	violations *violationRecorder
+
+	// queue holds the keys of services for the terminator to
+	// process.
+	queue workqueue.TypedRateLimitingInterface[string]
+
+	// reach is nil unless -probe-reachability.
+	reach *prober
+	// dns is nil unless -check-public-dns.
+	dns *dnsChecker
+	// idle is nil unless -detect-idle-loadbalancers.
+	idle *idleDetector
+	// reports is nil unless -policy-reports.
+	reports *policyReporter
+}
+
+// clusterConfigs returns the client config for each -context, by
+// name.  Without -context, there's just the one cluster, named by
+// -cluster-name.  -server, -token and -certificate-authority apply to
+// every cluster.
+func clusterConfigs() (map[string]*rest.Config, error) {
+	if len(contexts) == 0 {
+		if *kubeconfig == "" && *kubeServer == "" {
+			config, err := rest.InClusterConfig()
+			if err != nil {
+				return nil, err
+			}
+			// The service account token is re-read from
+			// its file as it's rotated, unless -token.
+			overrideInClusterConfig(config)
+			config.UserAgent = userAgent()
+			return map[string]*rest.Config{*clusterName: config}, nil
+		}
+		// Like BuildConfigFromFlags, only -kubeconfig is read.
+		rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeconfig}
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, kubeOverrides()).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.UserAgent = userAgent()
+		return map[string]*rest.Config{*clusterName: config}, nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	ret := make(map[string]*rest.Config)
+	for _, name := range contexts {
+		overrides := kubeOverrides()
+		overrides.CurrentContext = name
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.UserAgent = userAgent()
+		ret[name] = config
+	}
+	return ret, nil
+}
+
+// userAgent identifies our API requests in apiserver logs.
+func userAgent() string {
+	return fmt.Sprintf("kube-svc-watch/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// kubeOverrides returns kubeconfig overrides from the kubectl-style
+// flags.
+func kubeOverrides() *clientcmd.ConfigOverrides {
+	return &clientcmd.ConfigOverrides{
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:               *kubeServer,
+			CertificateAuthority: *kubeCAFile,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Token: *kubeToken,
+		},
+	}
+}
+
+// overrideInClusterConfig applies -token and -certificate-authority to
+// the in-cluster config, which doesn't come from a kubeconfig.
+func overrideInClusterConfig(config *rest.Config) {
+	if *kubeToken != "" {
+		config.BearerToken = *kubeToken
+		config.BearerTokenFile = ""
+	}
+	if *kubeCAFile != "" {
+		config.TLSClientConfig.CAFile = *kubeCAFile
+		config.TLSClientConfig.CAData = nil
+	}
+}
+
+// primaryCluster names the first cluster we watch, which holds our
+// own resources.
+func primaryCluster() string {
+	if len(contexts) > 0 {
+		return contexts[0]
+	}
+	return *clusterName
+}
+
+// deleteClient returns a client impersonating -as, if set, or else
+// client.
+func deleteClient(config *rest.Config, client kubernetes.Interface) (kubernetes.Interface, error) {
+	if *impersonateUser == "" {
+		if len(impersonateGroups) > 0 {
+			return nil, fmt.Errorf("-as-group requires -as")
+		}
+		return client, nil
+	}
+	config = rest.CopyConfig(config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: *impersonateUser,
+		Groups:   impersonateGroups,
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func newCluster(name string, config *rest.Config) (*cluster, error) {
+	// Not config.Timeout, which would also cut off watches.
+	config.QPS = float32(*apiQPS)
+	config.Burst = *apiBurst
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := selectServices()
+	if err != nil {
+		return nil, err
+	}
+	shard, err := shardFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cluster{
+		name:    name,
+		client:  clientset,
+		deleter: clientset,
+		factory: informers.NewSharedInformerFactory(clientset, 0),
+		queue:   workqueue.NewTypedRateLimitingQueue(workqueue.NewTypedItemExponentialFailureRateLimiter[string](*deleteRetryDelay, *deleteRetryMaxDelay)),
+	}
+	if c.deleter, err = deleteClient(config, clientset); err != nil {
+		return nil, err
+	}
+	c.factories = append(c.factories, c.factory)
+	if *detectIdle {
+		c.idle = newIdleDetector()
+	}
+	if len(namespaces) == 0 {
+		c.services = append(c.services, c.informerFor(c.factory, metav1.NamespaceAll, "services", &v1.Service{}, selector, shard))
+		c.store = c.services[0].GetStore()
+		if c.idle != nil {
+			c.idle.watch(c.informerFor(c.factory, metav1.NamespaceAll, "endpoints", &v1.Endpoints{}, nil, shard))
+		}
+	} else {
+		stores := multiStore{}
+		for _, ns := range namespaces {
+			f := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(ns))
+			c.factories = append(c.factories, f)
+			informer := c.informerFor(f, ns, "services", &v1.Service{}, selector, shard)
+			c.services = append(c.services, informer)
+			stores = append(stores, informer.GetStore())
+			if c.idle != nil {
+				c.idle.watch(c.informerFor(f, ns, "endpoints", &v1.Endpoints{}, nil, shard))
+			}
+		}
+		c.store = stores
+	}
+
+	if *probeReachability {
+		c.reach = newProber()
+	}
+	if *checkPublicDNS {
+		c.dns = newDNSChecker(splitList(*publicDNSServers))
+	}
+	if *recordViolations || *policyReports {
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		if *recordViolations {
+			c.violations, err = newViolationRecorder(client)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if *policyReports {
+			c.reports = newPolicyReporter(client, shard)
+		}
+	}
+	return c, nil
+}
+
+// requeueClusters has every cluster's terminator process every
+// service again, when the rules change.  It is set once the clusters
+// are created.
+var requeueClusters = func() {}
+
+// rescanLoop requeues every service every interval, until we stop.
+func rescanLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logDebug("Rescanning services")
+			requeueClusters()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// requeueAll has the terminator process every service again.
+func (c *cluster) requeueAll() {
+	for _, key := range c.store.ListKeys() {
+		c.queue.Add(key)
+	}
+}
+
+// watchNamespaces starts watching Namespaces if the current settings
+// look anything up on them, and we aren't already.
+func (c *cluster) watchNamespaces() {
+	if !cfg().usesNamespaces() {
+		return
+	}
+	c.nsMu.Lock()
+	defer c.nsMu.Unlock()
+	if c.nsStore != nil {
+		return
+	}
+	c.nsStore = c.informerFor(c.factory, metav1.NamespaceAll, "namespaces", &v1.Namespace{}, nil, nil).GetStore()
+	// Otherwise start will.
+	if c.started.Load() {
+		c.factory.Start(stopCh)
+	}
+}
+
+// namespaceStore returns the Namespace cache, or nil.
+func (c *cluster) namespaceStore() cache.Store {
+	c.nsMu.Lock()
+	defer c.nsMu.Unlock()
+	return c.nsStore
+}
+
+// register adds the cluster's collectors to the default registry,
+// with a cluster label.
+func (c *cluster) register(cs ...prometheus.Collector) {
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"cluster": c.name}, prometheus.DefaultRegisterer)
+	reg.MustRegister(cs...)
+}
+
+func (c *cluster) start() {
+	// Before starting, so watchNamespaces can't miss it.
+	c.started.Store(true)
+	for _, f := range c.factories {
+		f.Start(stopCh)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// parseControls parses -compliance-controls, which maps each rule, ie
+// reason a service can be public, to the compliance controls its
+// findings are evidence for.  Controls under "*" apply to every rule.
+// It is comma-separated rule=control pairs.  A rule may
+// be given more than once.
+func parseControls(s string) (map[string][]string, error) {
+	ret := make(map[string][]string)
+	for _, kv := range splitList(s) {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected rule=control, got %q", kv)
+		}
+		ret[parts[0]] = append(ret[parts[0]], parts[1])
+	}
+	return ret, nil
+}
+
+// controlsFor returns the controls mapped to rule, sorted.
+func controlsFor(rule string) []string {
+	seen := make(map[string]bool)
+	var ret []string
+	controls := cfg().controls
+	for _, c := range append(controls["*"], controls[rule]...) {
+		if !seen[c] {
+			seen[c] = true
+			ret = append(ret, c)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const envPrefix = "KUBE_SVC_WATCH_"
+
+// reloadable flags take effect on SIGHUP.  Changes to any others are
+// ignored until restart, since they would mean re-watching.
+var reloadable = map[string]bool{
+	"provider":  true,
+	"terminate": true,
+
+	"log-level":             true,
+	"log-format":            true,
+	"auth-token-file":       true,
+	"admin-token-file":      true,
+	"slack-token":           true,
+	"slack-channel":         true,
+	"splunk-hec-url":        true,
+	"splunk-hec-token":      true,
+	"elasticsearch-url":     true,
+	"elasticsearch-index":   true,
+	"bigquery-table":        true,
+	"falco-stdout":          true,
+	"alertmanager-url":      true,
+	"alertmanager-severity": true,
+	"owner-keys":            true,
+	"owner-slack-keys":      true,
+	"creator-email-keys":    true,
+	"owner-email-keys":      true,
+	"smtp-address":          true,
+	"smtp-from":             true,
+	"smtp-username":         true,
+	"smtp-password":         true,
+	"severity-tier-keys":    true,
+	"severity-tier-weights": true,
+	"loadbalancer-prices":   true,
+	"compliance-controls":   true,
+
+	"termination-delay":            true,
+	"namespace-termination-delays": true,
+	"termination-delay-keys":       true,
+
+	"min-severity-to-terminate":             true,
+	"min-severity-to-terminate-immediately": true,
+}
+
+// settings are the reloadable flags, parsed, and the state derived
+// from them.  A reload builds and validates a whole new settings,
+// then publishes it at once, so readers never see a half-applied
+// configuration.  Read the current settings with cfg(), never the
+// reloadable flags themselves.
+type settings struct {
+	provider  string
+	terminate bool
+
+	logLevel int
+	logJSON  bool
+
+	authToken  string
+	adminToken string
+
+	slackToken        string
+	slackChannel      string
+	splunkURL         string
+	splunkToken       string
+	esURL             string
+	esIndex           string
+	bigQueryInsertURL string
+	falcoStdout       bool
+	amURL             string
+	amSeverity        string
+	smtpAddr          string
+	smtpFrom          string
+	smtpUsername      string
+	smtpPassword      string
+
+	ownerKeys      []string
+	ownerSlackKeys []string
+	creatorKeys    []string
+	ownerEmailKeys []string
+	tierKeys       []string
+	tierWeights    map[string]float64
+	lbPrices       map[string]float64
+	controls       map[string][]string
+
+	terminationDelay  time.Duration
+	namespaceDelays   map[string]time.Duration
+	delayKeys         []string
+	scheduleSeverity  float64
+	immediateSeverity float64
+}
+
+var currentSettings atomic.Pointer[settings]
+
+func init() {
+	currentSettings.Store(&settings{})
+}
+
+// cfg returns the current settings.  Don't modify them.
+func cfg() *settings {
+	return currentSettings.Load()
+}
+
+// usesNamespaces reports whether anything is looked up on services'
+// Namespaces.
+func (st *settings) usesNamespaces() bool {
+	return len(st.ownerKeys) > 0 || len(st.ownerSlackKeys) > 0 || len(st.creatorKeys) > 0 ||
+		len(st.ownerEmailKeys) > 0 || len(st.tierKeys) > 0 || len(st.delayKeys) > 0
+}
+
+var (
+	// cmdline records the flags given on the command line, which
+	// override everything else, even across reloads.
+	cmdline map[string]bool
+
+	// applied is the raw value of every flag last set from the
+	// environment, config resource or config file.
+	applied map[string]string
+
+	// resourceSettings is the spec of the -config-resource, if
+	// any.  It is a map of flag names to values, like the config
+	// file.
+	resourceMu       sync.Mutex
+	resourceSettings map[string]interface{}
+)
+
+// envName returns the environment variable for a flag, eg
+// -slack-token is KUBE_SVC_WATCH_SLACK_TOKEN.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+// configValues returns the value of each flag that wasn't given on
+// the command line, first from the environment, then the config
+// resource and then the config file.  So the precedence is: command
+// line, environment, config resource, config file, default.
+//
+// The config file is a YAML map of flag names to values.  Repeatable
+// flags may be given a list.
+func configValues(fs *flag.FlagSet, path string) (map[string][]string, error) {
+	file := make(map[string]interface{})
+	if path != "" {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(buf, &file); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for name := range file {
+			if fs.Lookup(name) == nil {
+				return nil, fmt.Errorf("%s: unknown setting %q", path, name)
+			}
+		}
+	}
+	resourceMu.Lock()
+	for name, v := range resourceSettings {
+		if fs.Lookup(name) == nil {
+			resourceMu.Unlock()
+			return nil, fmt.Errorf("%s: unknown setting %q", *configResourceRef, name)
+		}
+		file[name] = v
+	}
+	resourceMu.Unlock()
+
+	ret := make(map[string][]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if cmdline[f.Name] {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			ret[f.Name] = []string{v}
+			return
+		}
+		v, ok := file[f.Name]
+		if !ok {
+			return
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, v := range values {
+			ret[f.Name] = append(ret[f.Name], fmt.Sprint(v))
+		}
+	})
+	return ret, nil
+}
+
+func setFlag(fs *flag.FlagSet, name string, values []string) error {
+	// Repeatable flags would otherwise add to their old values, so
+	// are built up separately and replaced at once.
+	if l, ok := fs.Lookup(name).Value.(*stringList); ok {
+		var list stringList
+		for _, v := range values {
+			if err := list.Set(v); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+		*l = list
+		return nil
+	}
+	for _, v := range values {
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// saveFlags returns a function restoring the current value of every
+// reloadable flag, and which were applied, for when a reload fails
+// partway.
+func saveFlags(fs *flag.FlagSet) (restore func()) {
+	values := make(map[string]string)
+	lists := make(map[string]stringList)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !reloadable[f.Name] {
+			return
+		}
+		if l, ok := f.Value.(*stringList); ok {
+			lists[f.Name] = append(stringList(nil), *l...)
+			return
+		}
+		values[f.Name] = f.Value.String()
+	})
+	oldApplied := make(map[string]string, len(applied))
+	for k, v := range applied {
+		oldApplied[k] = v
+	}
+	return func() {
+		for name, l := range lists {
+			*fs.Lookup(name).Value.(*stringList) = l
+		}
+		for name, v := range values {
+			fs.Set(name, v)
+		}
+		applied = oldApplied
+	}
+}
+
+// loadConfig fills in flags that weren't given on the command line.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	cmdline = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { cmdline[f.Name] = true })
+
+	values, err := configValues(fs, path)
+	if err != nil {
+		return err
+	}
+	applied = make(map[string]string)
+	for name, v := range values {
+		if err := setFlag(fs, name, v); err != nil {
+			return err
+		}
+		applied[name] = strings.Join(v, ",")
+	}
+	return nil
+}
+
+// reloadConfig re-reads the environment, config resource and config
+// file, applying changes to reloadable flags and returning their
+// names.  Flags that are no longer set revert to their defaults.
+func reloadConfig(fs *flag.FlagSet, path string) ([]string, error) {
+	return updateConfig(fs, path, false)
+}
+
+// updateConfig is reloadConfig, but if starting, changes to every
+// flag are applied.
+func updateConfig(fs *flag.FlagSet, path string, starting bool) ([]string, error) {
+	values, err := configValues(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string][]string)
+	var pending []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if cmdline[f.Name] {
+			return
+		}
+		v, ok := values[f.Name]
+		if !ok {
+			v = []string{f.DefValue}
+		}
+		raw := strings.Join(v, ",")
+		old, ok := applied[f.Name]
+		if !ok {
+			old = f.DefValue
+		}
+		if raw == old {
+			return
+		}
+		if !reloadable[f.Name] && !starting {
+			logWarn("Setting can't be changed without a restart", "setting", f.Name)
+			pending = append(pending, f.Name)
+			return
+		}
+		changed[f.Name] = v
+	})
+
+	var names []string
+	for name, v := range changed {
+		if err := setFlag(fs, name, v); err != nil {
+			return nil, err
+		}
+		applied[name] = strings.Join(v, ",")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	restartMu.Lock()
+	restartPending = pending
+	restartMu.Unlock()
+	return names, nil
+}
+
+var (
+	restartMu sync.Mutex
+	// restartPending holds the settings changed by the last
+	// reload that can't take effect until we restart.
+	restartPending []string
+)
+
+// pendingRestart returns the settings whose changes are waiting for a
+// restart.
+func pendingRestart() []string {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	return restartPending
+}
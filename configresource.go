@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// KubeSvcWatches are defined by crds/kubesvcwatches.yaml.
+var configResourceType = schema.GroupVersionResource{
+	Group:    "kubesvcwatch.anguslees.github.io",
+	Version:  "v1alpha1",
+	Resource: "kubesvcwatches",
+}
+
+// How often the config resource's status is refreshed.
+const configStatusInterval = 30 * time.Second
+
+// configResource is the KubeSvcWatch named by -config-resource.  Its
+// spec holds settings, and its status reports whether they were
+// applied, whether any are waiting for a restart, whether we're
+// ready, and the last action taken.
+type configResource struct {
+	client    dynamic.ResourceInterface
+	namespace string
+	name      string
+
+	mu         sync.Mutex
+	generation int64
+	conditions map[string]map[string]interface{}
+}
+
+// newConfigResource finds the resource named by ref, in the first
+// cluster we watch.
+func newConfigResource(ref string) (*configResource, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("-config-resource must be namespace/name, got %q", ref)
+	}
+	configs, err := clusterConfigs()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(configs[primaryCluster()])
+	if err != nil {
+		return nil, err
+	}
+	return &configResource{
+		client:     client.Resource(configResourceType).Namespace(parts[0]),
+		namespace:  parts[0],
+		name:       parts[1],
+		conditions: make(map[string]map[string]interface{}),
+	}, nil
+}
+
+// fetch loads the resource's settings, for the configuration to be
+// (re)loaded.
+func (r *configResource) fetch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	obj, err := r.client.Get(ctx, r.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	r.setSpec(obj)
+	return nil
+}
+
+func (r *configResource) setSpec(obj *unstructured.Unstructured) {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	resourceMu.Lock()
+	resourceSettings = spec
+	resourceMu.Unlock()
+
+	r.mu.Lock()
+	r.generation = obj.GetGeneration()
+	r.mu.Unlock()
+}
+
+// setCondition records a status condition.  Its transition time only
+// changes along with its status.
+func (r *configResource) setCondition(kind string, err error, reason string) {
+	status, message := "True", ""
+	if err != nil {
+		status, message = "False", err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.conditions[kind]
+	transition := time.Now().UTC().Format(time.RFC3339)
+	if old != nil && old["status"] == status {
+		transition = old["lastTransitionTime"].(string)
+	}
+	r.conditions[kind] = map[string]interface{}{
+		"type":               kind,
+		"status":             status,
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": transition,
+	}
+}
+
+// run applies changes to the resource with apply, and keeps its
+// status up to date, until we stop.
+func (r *configResource) run(apply func() error) {
+	r.setCondition("ConfigApplied", nil, "Applied")
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = "metadata.name=" + r.name
+			return r.client.List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = "metadata.name=" + r.name
+			return r.client.Watch(context.Background(), options)
+		},
+	}
+	changed := func(obj interface{}) {
+		u := obj.(*unstructured.Unstructured)
+		r.mu.Lock()
+		seen := u.GetGeneration() == r.generation
+		r.mu.Unlock()
+		if seen {
+			return
+		}
+		logInfo("Config resource changed", "resource", r.namespace+"/"+r.name, "generation", u.GetGeneration())
+		r.setSpec(u)
+		if err := apply(); err != nil {
+			logError("Error applying config resource", "resource", r.namespace+"/"+r.name, "error", err)
+			r.setCondition("ConfigApplied", err, "Invalid")
+		} else {
+			r.setCondition("ConfigApplied", nil, "Applied")
+		}
+		r.updateStatus()
+	}
+	informer := cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    changed,
+		UpdateFunc: func(_, obj interface{}) { changed(obj) },
+	})
+	go informer.Run(stopCh)
+
+	ticker := time.NewTicker(configStatusInterval)
+	defer ticker.Stop()
+	for {
+		r.updateStatus()
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// updateStatus writes the resource's status, if it has changed.
+func (r *configResource) updateStatus() {
+	var notReady error
+	if problems := health.problems(true); len(problems) > 0 {
+		notReady = fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	r.setCondition("Ready", notReady, "Health")
+	if names := pendingRestart(); len(names) > 0 {
+		r.setCondition("Reconciled", fmt.Errorf("%s can't be changed without a restart", strings.Join(names, ", ")), "RestartRequired")
+	} else {
+		r.setCondition("Reconciled", nil, "Reconciled")
+	}
+
+	r.mu.Lock()
+	status := map[string]interface{}{
+		"observedGeneration": r.generation,
+		"conditions": []interface{}{
+			r.conditions["ConfigApplied"],
+			r.conditions["Reconciled"],
+			r.conditions["Ready"],
+		},
+	}
+	r.mu.Unlock()
+	if evs := recent.list(); len(evs) > 0 {
+		status["lastAction"] = map[string]interface{}{
+			"time":      evs[0].Time.Format(time.RFC3339),
+			"cluster":   evs[0].Cluster,
+			"action":    evs[0].Action,
+			"namespace": evs[0].Namespace,
+			"name":      evs[0].Name,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	obj, err := r.client.Get(ctx, r.name, metav1.GetOptions{})
+	if err != nil {
+		logError("Error fetching config resource", "resource", r.namespace+"/"+r.name, "error", err)
+		return
+	}
+	// Round-trip through JSON types, so unchanged statuses
+	// compare equal.
+	status = runtime.DeepCopyJSON(status)
+	if old, _, _ := unstructured.NestedMap(obj.Object, "status"); reflect.DeepEqual(old, status) {
+		return
+	}
+	obj.Object["status"] = status
+	if _, err := r.client.UpdateStatus(ctx, obj, metav1.UpdateOptions{FieldManager: *fieldManagerName}); err != nil {
+		logError("Error updating config resource status", "resource", r.namespace+"/"+r.name, "error", err)
+	}
+}
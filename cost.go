@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+
+	"k8s.io/api/core/v1"
+)
+
+const awsLbType = "service.beta.kubernetes.io/aws-load-balancer-type"
+
+// defaultLbPrices are on-demand hourly prices in USD, keyed by
+// lbPriceKey.  Regional pricing varies, so override these with
+// -loadbalancer-prices.
+var defaultLbPrices = map[string]float64{
+	"aws":     0.025,  // Classic Load Balancer
+	"aws-nlb": 0.0225, // Network Load Balancer
+	"gcp":     0.025,  // Forwarding rule
+}
+
+func lbPriceKey(svc *v1.Service) string {
+	provider := cfg().provider
+	if provider == "aws" && svc.Annotations[awsLbType] == "nlb" {
+		return "aws-nlb"
+	}
+	return provider
+}
+
+// lbHourlyCost returns the estimated hourly cost of svc's load
+// balancer, and false if it doesn't have one or the price is
+// unknown.
+func lbHourlyCost(svc *v1.Service) (float64, bool) {
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return 0, false
+	}
+	price, ok := cfg().lbPrices[lbPriceKey(svc)]
+	return price, ok
+}
+
+// Average hours in a month, for monthly estimates.
+const hoursPerMonth = 730
+
+// namespaceCost summarises the load balancers in a namespace.  Costs
+// are 0 unless -loadbalancer-cost.
+type namespaceCost struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+
+	External int `json:"external"`
+	Internal int `json:"internal"`
+
+	ExternalHourlyCost  float64 `json:"externalHourlyCost"`
+	InternalHourlyCost  float64 `json:"internalHourlyCost"`
+	ExternalMonthlyCost float64 `json:"externalMonthlyCost"`
+	InternalMonthlyCost float64 `json:"internalMonthlyCost"`
+}
+
+// namespaceCosts summarises the load balancers in each namespace of c.
+func (c *cluster) namespaceCosts() map[string]*namespaceCost {
+	ret := make(map[string]*namespaceCost)
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		nc, ok := ret[svc.Namespace]
+		if !ok {
+			nc = &namespaceCost{Cluster: c.name, Namespace: svc.Namespace}
+			ret[svc.Namespace] = nc
+		}
+		cost, _ := lbHourlyCost(svc)
+		if !isExposed(svc) {
+			nc.Internal++
+			nc.InternalHourlyCost += cost
+		} else {
+			nc.External++
+			nc.ExternalHourlyCost += cost
+		}
+	}
+	for _, nc := range ret {
+		nc.ExternalMonthlyCost = nc.ExternalHourlyCost * hoursPerMonth
+		nc.InternalMonthlyCost = nc.InternalHourlyCost * hoursPerMonth
+	}
+	return ret
+}
+
+// costReport lists the load balancers of each namespace in every
+// cluster, most expensive external ones first.
+func costReport(clusters []*cluster) []*namespaceCost {
+	ret := []*namespaceCost{}
+	for _, c := range clusters {
+		for _, nc := range c.namespaceCosts() {
+			ret = append(ret, nc)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.ExternalHourlyCost != b.ExternalHourlyCost {
+			return a.ExternalHourlyCost > b.ExternalHourlyCost
+		}
+		if a.External != b.External {
+			return a.External > b.External
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Namespace < b.Namespace
+	})
+	return ret
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+// handlePprof registers the net/http/pprof handlers, plus /debug/dump.
+func handlePprof(ls listeners, addr string) {
+	ls.handle(addr, "/debug/pprof/", authenticated(http.HandlerFunc(pprof.Index)))
+	ls.handle(addr, "/debug/pprof/cmdline", authenticated(http.HandlerFunc(pprof.Cmdline)))
+	ls.handle(addr, "/debug/pprof/profile", authenticated(http.HandlerFunc(pprof.Profile)))
+	ls.handle(addr, "/debug/pprof/symbol", authenticated(http.HandlerFunc(pprof.Symbol)))
+	ls.handle(addr, "/debug/pprof/trace", authenticated(http.HandlerFunc(pprof.Trace)))
+	ls.handle(addr, "/debug/dump", authenticated(http.HandlerFunc(dumpHandler)))
+}
+
+// dumpHandler writes goroutine stacks and a heap profile to -dump-dir,
+// for when the process is too unwell to stream a profile back.
+func dumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, p := range []struct {
+		name  string
+		debug int
+	}{
+		{"goroutine", 2},
+		{"heap", 0},
+	} {
+		path := filepath.Join(*dumpDir, fmt.Sprintf("kube-svc-watch-%s-%s", p.name, stamp))
+		if err := writeProfile(path, p.name, p.debug); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, path)
+	}
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := runtimepprof.Lookup(name).WriteTo(f, debug); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
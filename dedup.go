@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	"k8s.io/api/core/v1"
+)
+
+// deduper suppresses repeated notifications for the same violation
+// within a cool-off window.  Services are tracked by UID, so a
+// delete-recreate is always a new violation.  What we've notified is
+// saved to the state store under stateKey, so a restart doesn't
+// notify everything again.
+type deduper struct {
+	window   time.Duration
+	stateKey string
+
+	mu        sync.Mutex
+	seen      map[string]dedupEntry
+	lastSweep time.Time
+}
+
+type dedupEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Notified    time.Time `json:"notified"`
+}
+
+func newDeduper(window time.Duration, stateKey string) *deduper {
+	d := &deduper{
+		window:   window,
+		stateKey: stateKey,
+		seen:     make(map[string]dedupEntry),
+	}
+	if err := state.get(stateKey, &d.seen); err != nil {
+		logError("Error restoring notified violations", "key", stateKey, "error", err)
+	}
+	return d
+}
+
+// violationFingerprint summarises the parts of svc that make up a
+// violation, so a change to any of them is notified afresh.
+func violationFingerprint(svc *v1.Service) string {
+	ports := make([]string, 0, len(svc.Spec.Ports))
+	for _, p := range svc.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%s/%d:%d", p.Protocol, p.Port, p.NodePort))
+	}
+	sort.Strings(ports)
+	ranges := append([]string(nil), svc.Spec.LoadBalancerSourceRanges...)
+	sort.Strings(ranges)
+
+	return strings.Join([]string{
+		string(svc.Spec.Type),
+		svc.Annotations[detect.AWSLbInternal],
+		svc.Annotations[detect.GCPLbInternal],
+		strings.Join(ports, ","),
+		strings.Join(ranges, ","),
+	}, "|")
+}
+
+// shouldNotify records a violation for svc, and reports whether it
+// is new or changed enough to be worth notifying.
+func (d *deduper) shouldNotify(svc *v1.Service) bool {
+	if d.window <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	key := string(svc.UID)
+	fp := violationFingerprint(svc)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastSweep) > d.window {
+		for k, e := range d.seen {
+			if now.Sub(e.Notified) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if e, ok := d.seen[key]; ok && e.Fingerprint == fp && now.Sub(e.Notified) < d.window {
+		return false
+	}
+	d.seen[key] = dedupEntry{Fingerprint: fp, Notified: now}
+	state.set(d.stateKey, d.seen)
+	return true
+}
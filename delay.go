@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// scheduledTerminationAnnotation tells a service's owner when we'll
+// delete it, unless it's fixed first.
+const scheduledTerminationAnnotation = "kube-svc-watch/scheduled-termination"
+
+// parseDurationMap parses comma-separated key=duration pairs, as in
+// -namespace-termination-delays.
+func parseDurationMap(s string) (map[string]time.Duration, error) {
+	ret := make(map[string]time.Duration)
+	for _, kv := range splitList(s) {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", kv)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad value for %s: %s", parts[0], err)
+		}
+		ret[parts[0]] = d
+	}
+	return ret, nil
+}
+
+// terminationDelay returns how long a service in namespace may be
+// public before we delete it: from the Namespace's metadata if
+// -termination-delay-keys names it, else -namespace-termination-delays,
+// else -termination-delay.
+func (c *cluster) terminationDelay(namespace string) time.Duration {
+	st := cfg()
+	if v := c.namespaceValue(namespace, st.delayKeys); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+		logWarn("Ignoring bad termination delay", "namespace", namespace, "value", v, "error", err)
+	}
+	if d, ok := st.namespaceDelays[namespace]; ok {
+		return d
+	}
+	return st.terminationDelay
+}
+
+// terminationDeadline returns when svc, public since the given time,
+// is due to be deleted.  A deadline we annotated before restarting
+// still applies if it's sooner.
+func (c *cluster) terminationDeadline(svc *v1.Service, since time.Time) time.Time {
+	deadline := since.Add(c.terminationDelay(svc.Namespace))
+	if t, err := time.Parse(time.RFC3339, svc.Annotations[scheduledTerminationAnnotation]); err == nil && t.Before(deadline) {
+		return t
+	}
+	return deadline
+}
+
+// markScheduled annotates svc with when it will be deleted.
+func (c *cluster) markScheduled(svc *v1.Service, deadline time.Time) {
+	value := deadline.UTC().Format(time.RFC3339)
+	if svc.Annotations[scheduledTerminationAnnotation] == value {
+		return
+	}
+	c.patchAnnotation(svc, scheduledTerminationAnnotation, value)
+}
+
+// unmarkScheduled removes the scheduled termination annotation from a
+// service that was fixed or exempted in time.
+func (c *cluster) unmarkScheduled(svc *v1.Service) {
+	if _, ok := svc.Annotations[scheduledTerminationAnnotation]; !ok {
+		return
+	}
+	c.patchAnnotation(svc, scheduledTerminationAnnotation, nil)
+}
+
+// patchAnnotation sets annotation key on svc to value, or removes it
+// if value is nil.
+func (c *cluster) patchAnnotation(svc *v1.Service, key string, value interface{}) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{key: value},
+		},
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	_, err = c.deleter.CoreV1().Services(svc.Namespace).Patch(ctx, svc.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: *fieldManagerName})
+	if err != nil && !errors.IsNotFound(err) {
+		logWarn("Error annotating service", "namespace", svc.Namespace, "service", svc.Name, "annotation", key, "error", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anguslees/kube-svc-watch/pkg/terminate"
+	"k8s.io/api/core/v1"
+)
+
+// serviceDiff describes what changed from old to svc in the fields
+// that decide whether a service is public, eg
+// `spec.type: ClusterIP -> LoadBalancer`.
+func serviceDiff(old, svc *v1.Service) []string {
+	var ret []string
+	if old.Spec.Type != svc.Spec.Type {
+		ret = append(ret, fmt.Sprintf("spec.type: %s -> %s", old.Spec.Type, svc.Spec.Type))
+	}
+
+	keys := make(map[string]bool)
+	for k := range old.Annotations {
+		keys[k] = true
+	}
+	for k := range svc.Annotations {
+		keys[k] = true
+	}
+	var changed []string
+	for k := range keys {
+		if k == terminate.PendingAnnotation || k == scheduledTerminationAnnotation {
+			continue
+		}
+		before, hadBefore := old.Annotations[k]
+		after, hasAfter := svc.Annotations[k]
+		switch {
+		case !hadBefore:
+			changed = append(changed, fmt.Sprintf("annotation %s: added %q", k, after))
+		case !hasAfter:
+			changed = append(changed, fmt.Sprintf("annotation %s: removed (was %q)", k, before))
+		case before != after:
+			changed = append(changed, fmt.Sprintf("annotation %s: %q -> %q", k, before, after))
+		}
+	}
+	sort.Strings(changed)
+	ret = append(ret, changed...)
+
+	before := strings.Join(old.Spec.LoadBalancerSourceRanges, ",")
+	after := strings.Join(svc.Spec.LoadBalancerSourceRanges, ",")
+	if before != after {
+		ret = append(ret, fmt.Sprintf("spec.loadBalancerSourceRanges: [%s] -> [%s]", before, after))
+	}
+	return ret
+}
+
+// changeLog holds the diffs of services that updates have made
+// violations, until the terminator processes them.
+type changeLog struct {
+	mu      sync.Mutex
+	changes map[string][]string
+}
+
+func newChangeLog() *changeLog {
+	return &changeLog{changes: make(map[string][]string)}
+}
+
+func (l *changeLog) set(key string, diff []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changes[key] = diff
+}
+
+// take returns and forgets the diff recorded for key.
+func (l *changeLog) take(key string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	diff := l.changes[key]
+	delete(l.changes, key)
+	return diff
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// externalDNSAnnotation lists the hostnames external-dns publishes for
+// a service.
+const externalDNSAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+var publicDNS = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kube_svc_watch_service_public_dns",
+		Help: "Whether each load balancer or external-dns hostname of a public service resolves on the public DNS servers (1) or not (0), at the last check.",
+	},
+	[]string{"cluster", "namespace", "service", "hostname"},
+)
+
+// dnsChecker periodically resolves the hostnames of public services
+// on public DNS servers, to tell which are published to the internet.
+type dnsChecker struct {
+	servers []string
+
+	mu sync.Mutex
+	// public holds the hostnames of each service that resolved.
+	public map[types.UID][]string
+}
+
+func newDNSChecker(servers []string) *dnsChecker {
+	return &dnsChecker{servers: servers, public: make(map[types.UID][]string)}
+}
+
+// lookup returns the hostnames of svc that resolved publicly at the
+// last check.
+func (d *dnsChecker) lookup(svc *v1.Service) []string {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.public[svc.UID]
+}
+
+// run checks c's public services every -public-dns-interval, until we
+// stop.
+func (d *dnsChecker) run(c *cluster) {
+	ticker := time.NewTicker(*publicDNSInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.checkAll(c)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (d *dnsChecker) checkAll(c *cluster) {
+	publicDNS.DeletePartialMatch(prometheus.Labels{"cluster": c.name})
+	public := make(map[types.UID][]string)
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if !isExposed(svc) {
+			continue
+		}
+		for _, host := range serviceHostnames(svc) {
+			resolved, err := d.resolves(host)
+			if err != nil {
+				logWarn("Error resolving hostname", "namespace", svc.Namespace, "service", svc.Name, "hostname", host, "error", err)
+				continue
+			}
+			v := 0.0
+			if resolved {
+				v = 1
+				public[svc.UID] = append(public[svc.UID], host)
+			}
+			publicDNS.WithLabelValues(c.name, svc.Namespace, svc.Name, host).Set(v)
+		}
+	}
+
+	d.mu.Lock()
+	d.public = public
+	d.mu.Unlock()
+}
+
+// resolves reports whether host has addresses on the public DNS
+// servers, trying each server in turn until one answers.
+func (d *dnsChecker) resolves(host string) (bool, error) {
+	var err error
+	for _, server := range d.servers {
+		server := server
+		r := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *publicDNSTimeout)
+		var addrs []string
+		addrs, err = r.LookupHost(ctx, host)
+		cancel()
+		if err == nil {
+			return len(addrs) > 0, nil
+		}
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return false, nil
+		}
+	}
+	return false, err
+}
+
+// serviceHostnames returns svc's load balancer hostnames and those
+// external-dns publishes for it.
+func serviceHostnames(svc *v1.Service) []string {
+	seen := make(map[string]bool)
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			seen[ingress.Hostname] = true
+		}
+	}
+	for _, host := range splitList(svc.Annotations[externalDNSAnnotation]) {
+		seen[host] = true
+	}
+	ret := make([]string, 0, len(seen))
+	for host := range seen {
+		ret = append(ret, host)
+	}
+	sort.Strings(ret)
+	return ret
+}
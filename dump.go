@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// stateDump is what SIGUSR1 dumps, for debugging why a service was or
+// wasn't deleted.
+type stateDump struct {
+	Time        time.Time            `json:"time"`
+	PausedUntil *time.Time           `json:"pausedUntil,omitempty"`
+	Snoozes     map[string]time.Time `json:"snoozes,omitempty"`
+	Notifiers   []string             `json:"notifiers"`
+	Problems    []string             `json:"problems,omitempty"`
+	Clusters    []clusterDump        `json:"clusters"`
+}
+
+type clusterDump struct {
+	Name     string           `json:"name"`
+	ReadOnly bool             `json:"readOnly"`
+	Queued   int              `json:"queued"`
+	Services []classification `json:"services"`
+}
+
+// classification is how we see a single service.
+type classification struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason,omitempty"`
+	Exempt    string `json:"exempt,omitempty"`
+	Violation bool   `json:"violation"`
+}
+
+func newStateDump(clusters []*cluster, notify *liveNotifiers) *stateDump {
+	d := &stateDump{
+		Time:     time.Now().UTC(),
+		Problems: health.problems(true),
+		Snoozes:  make(map[string]time.Time),
+	}
+	if until := pause.pausedUntil(); !until.IsZero() {
+		until = until.UTC()
+		d.PausedUntil = &until
+	}
+	snoozes.mu.Lock()
+	for k, t := range snoozes.until {
+		d.Snoozes[k] = t
+	}
+	snoozes.mu.Unlock()
+	for _, n := range notify.get() {
+		d.Notifiers = append(d.Notifiers, n.Name())
+	}
+
+	for _, c := range clusters {
+		cd := clusterDump{
+			Name:     c.name,
+			ReadOnly: c.readOnly.Load(),
+			Queued:   c.queue.Len(),
+		}
+		for _, item := range c.store.List() {
+			svc := item.(*v1.Service)
+			cd.Services = append(cd.Services, classification{
+				Namespace: svc.Namespace,
+				Name:      svc.Name,
+				Type:      string(svc.Spec.Type),
+				Reason:    externalReason(svc),
+				Exempt:    exemptReason(svc),
+				Violation: isViolation(svc),
+			})
+		}
+		sort.Slice(cd.Services, func(i, j int) bool {
+			a, b := cd.Services[i], cd.Services[j]
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		})
+		d.Clusters = append(d.Clusters, cd)
+	}
+	return d
+}
+
+// dumpState writes the state dump to -state-dump-file, or else logs it
+// a line at a time.
+func dumpState(clusters []*cluster, notify *liveNotifiers) {
+	d := newStateDump(clusters, notify)
+	if *stateDumpFile != "" {
+		buf, err := json.MarshalIndent(d, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(*stateDumpFile, buf, 0644)
+		}
+		if err != nil {
+			logError("Error writing state dump", "file", *stateDumpFile, "error", err)
+			return
+		}
+		logInfo("Wrote state dump", "file", *stateDumpFile)
+		return
+	}
+
+	paused := ""
+	if d.PausedUntil != nil {
+		paused = d.PausedUntil.Format(time.RFC3339)
+	}
+	logInfo("State dump", "paused_until", paused, "notifiers", strings.Join(d.Notifiers, ","), "problems", strings.Join(d.Problems, "; "))
+	for k, t := range d.Snoozes {
+		logInfo("State dump: snooze", "service", k, "until", t.Format(time.RFC3339))
+	}
+	for _, cd := range d.Clusters {
+		logInfo("State dump: cluster", "cluster", cd.Name, "read_only", cd.ReadOnly, "queued", cd.Queued, "services", len(cd.Services))
+		for _, s := range cd.Services {
+			logInfo("State dump: service", "cluster", cd.Name, "namespace", s.Namespace, "service", s.Name, "type", s.Type, "reason", s.Reason, "exempt", s.Exempt, "violation", s.Violation)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sort"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// lbSelector identifies the pods a service selects.
+type lbSelector struct {
+	namespace string
+	selector  string
+}
+
+// duplicateLoadBalancers returns the public LoadBalancer services in
+// store that select the same pods as another, by their selector.
+// These are often left behind by renames in Helm upgrades, and each
+// is extra exposure and cost.
+func duplicateLoadBalancers(store cache.Store) map[lbSelector][]string {
+	bySelector := make(map[lbSelector][]string)
+	for _, item := range store.List() {
+		svc := item.(*v1.Service)
+		if svc.Spec.Type != v1.ServiceTypeLoadBalancer || !isExposed(svc) || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		key := lbSelector{svc.Namespace, labels.SelectorFromSet(svc.Spec.Selector).String()}
+		bySelector[key] = append(bySelector[key], svc.Name)
+	}
+	for key, names := range bySelector {
+		if len(names) < 2 {
+			delete(bySelector, key)
+			continue
+		}
+		sort.Strings(names)
+	}
+	return bySelector
+}
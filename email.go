@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+)
+
+// Timeout for each email, from connecting to the SMTP server to it
+// accepting the message.
+const smtpTimeout = 30 * time.Second
+
+// emailNotifier emails violations and terminations to the owners of
+// the services, as found with -owner-email-keys.
+type emailNotifier struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+func newEmailNotifier(addr, from, username, password string) *emailNotifier {
+	return &emailNotifier{addr: addr, from: from, username: username, password: password}
+}
+
+func (n *emailNotifier) Name() string {
+	return "email"
+}
+
+func (n *emailNotifier) Notify(ev *event) error {
+	var subject, body string
+	switch ev.Action {
+	case actionDetected:
+		subject = fmt.Sprintf("Public Service %s/%s in %s", ev.Namespace, ev.Name, ev.Cluster)
+		body = fmt.Sprintf("kube-svc-watch found that Service %s/%s in cluster %s is exposed to the internet (%s).\n\nPlease make it internal, or get an exemption.", ev.Namespace, ev.Name, ev.Cluster, ev.Reason)
+		if ev.Termination != nil && ev.Termination.After(ev.Time) {
+			body += fmt.Sprintf(" Otherwise it will be deleted at %s.", ev.Termination.UTC().Format(time.RFC1123))
+		}
+	case actionDeleted:
+		subject = fmt.Sprintf("Deleted public Service %s/%s in %s", ev.Namespace, ev.Name, ev.Cluster)
+		body = fmt.Sprintf("kube-svc-watch deleted Service %s/%s in cluster %s, since it was exposed to the internet (%s).", ev.Namespace, ev.Name, ev.Cluster, ev.Reason)
+	case actionDeleteFailed:
+		subject = fmt.Sprintf("Public Service %s/%s in %s could not be deleted", ev.Namespace, ev.Name, ev.Cluster)
+		body = fmt.Sprintf("kube-svc-watch gave up trying to delete Service %s/%s in cluster %s, which is exposed to the internet (%s): %s", ev.Namespace, ev.Name, ev.Cluster, ev.Reason, ev.Error)
+	case actionIdleDeleted:
+		subject = fmt.Sprintf("Deleted unused public Service %s/%s in %s", ev.Namespace, ev.Name, ev.Cluster)
+		body = fmt.Sprintf("kube-svc-watch deleted Service %s/%s in cluster %s, which was exposed to the internet but hadn't had any ready pods for over %s.", ev.Namespace, ev.Name, ev.Cluster, *idleDeleteAfter)
+	default:
+		return nil
+	}
+
+	// The addresses come from annotations anyone with access to the
+	// namespace can set, so mustn't be trusted in headers.
+	var to []string
+	for _, addr := range ev.OwnerEmail {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			logWarn("Ignoring bad owner email address", "namespace", ev.Namespace, "service", ev.Name, "address", addr, "error", err)
+			continue
+		}
+		to = append(to, a.Address)
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	if len(ev.Changes) > 0 {
+		body += "\n\nChanged: " + strings.Join(ev.Changes, "; ")
+	}
+	if ev.ChangedBy != "" {
+		body += fmt.Sprintf("\nLast changed by: %s", ev.ChangedBy)
+	}
+	if len(ev.PublicHostnames) > 0 {
+		body += fmt.Sprintf("\nPublished in public DNS as: %s", strings.Join(ev.PublicHostnames, ", "))
+	}
+
+	err := n.send(to, subject, body+"\n")
+	metrics.CountNotifications(n.Name(), 1, err)
+	if err != nil {
+		return err
+	}
+	logInfo("Sent notification", "backend", n.Name(), "action", ev.Action, "namespace", ev.Namespace, "service", ev.Name, "to", strings.Join(to, ","))
+	return nil
+}
+
+// send emails a plain text message to each of to.
+func (n *emailNotifier) send(to []string, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	// Unlike smtp.SendMail, this can't hang forever.
+	conn, err := net.DialTimeout("tcp", n.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	host, _, err := net.SplitHostPort(n.addr)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("%s: %v", addr, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
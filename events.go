@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/notify"
+	"k8s.io/api/core/v1"
+)
+
+// Shorthands for pkg/notify, which the notifiers here implement.
+const (
+	actionDetected            = notify.ActionDetected
+	actionDeleted             = notify.ActionDeleted
+	actionDeleteFailed        = notify.ActionDeleteFailed
+	actionLbPending           = notify.ActionLbPending
+	actionIdleDeleted         = notify.ActionIdleDeleted
+	actionEnforcementDisabled = notify.ActionEnforcementDisabled
+)
+
+type (
+	event     = notify.Event
+	notifier  = notify.Notifier
+	notifiers = notify.Notifiers
+)
+
+func newEvent(c *cluster, action string, svc *v1.Service) *event {
+	owner, ownerSlack := c.lookupOwner(svc.Namespace)
+	ev := &event{
+		Time:      time.Now().UTC(),
+		Cluster:   c.name,
+		Action:    action,
+		Namespace: svc.Namespace,
+		Name:      svc.Name,
+		UID:       string(svc.UID),
+		Type:      string(svc.Spec.Type),
+		Reason:    externalReason(svc),
+
+		Owner:             owner,
+		OwnerSlackChannel: ownerSlack,
+
+		CreatorEmail: c.lookupCreator(svc),
+		OwnerEmail:   c.lookupOwnerEmail(svc),
+
+		FieldManager: fieldManager(svc),
+		ChangedBy:    audit.lookup(c.name, svc),
+	}
+	if r, ok := c.reach.lookup(svc); ok {
+		ev.Reachable = &r.reachable
+	}
+	ev.PublicHostnames = c.dns.lookup(svc)
+	return ev
+}
+
+// notifyAll hands ev to each of ns that wants it, tracing each
+// delivery under parent.
+func notifyAll(ns notifiers, ev *event, parent *span) {
+	for _, n := range ns {
+		if !notify.Wants(n, ev) {
+			continue
+		}
+		s := startSpan(parent, "notify", spanKindClient, "backend", n.Name(), "action", ev.Action)
+		err := n.Notify(ev)
+		s.finish(err)
+		if err != nil {
+			logError("Error sending event", "action", ev.Action, "namespace", ev.Namespace, "service", ev.Name, "backend", n.Name(), "error", err)
+		}
+	}
+}
+
+// liveNotifiers is the current set of notifiers, which is replaced
+// when the configuration is reloaded.
+type liveNotifiers struct {
+	mu      sync.RWMutex
+	current notifiers
+}
+
+func (l *liveNotifiers) get() notifiers {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.current
+}
+
+// set replaces the notifiers.  Once nothing is still notifying the
+// old ones, the new ones adopt their state and they're closed,
+// delivering everything they were given.
+func (l *liveNotifiers) set(ns notifiers) {
+	l.mu.Lock()
+	old := l.current
+	l.current = ns
+	l.mu.Unlock()
+	for _, n := range ns {
+		if a, ok := n.(notify.Adopter); ok {
+			a.Adopt(old)
+		}
+	}
+	old.Close()
+}
+
+// notify hands ev to the current notifiers, tracing each delivery
+// under parent, if set.
+func (l *liveNotifiers) notify(ev *event, parent *span) {
+	// Held throughout, so set can't close the notifiers under us.
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	notifyAll(l.current, ev, parent)
+}
+
+func (l *liveNotifiers) close() {
+	l.get().Close()
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"io"
+
+	"github.com/anguslees/kube-svc-watch/pkg/notify"
+)
+
+// newFalcoNotifier returns a notifier that writes events to w as
+// Falco alerts, tagged with the compliance controls they break.
+func newFalcoNotifier(w io.Writer) notifier {
+	return notify.NewFalco(w, controlsFor)
+}
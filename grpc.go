@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Streamed events are buffered this much per client.
+const grpcStreamBuffer = 100
+
+// subscribers receives every event, for StreamEvents.
+var subscribers = &broadcaster{subs: make(map[chan *event]bool)}
+
+// broadcaster is a notifier that copies events to any number of
+// subscribers.  Slow subscribers miss events rather than holding up
+// the others.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan *event]bool
+}
+
+func (b *broadcaster) Name() string {
+	return "grpc"
+}
+
+func (b *broadcaster) Notify(ev *event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+			metrics.CountNotifications("grpc", 1, nil)
+		default:
+			metrics.CountDropped("grpc")
+		}
+	}
+	return nil
+}
+
+func (b *broadcaster) subscribe() chan *event {
+	ch := make(chan *event, grpcStreamBuffer)
+	b.mu.Lock()
+	b.subs[ch] = true
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan *event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+}
+
+// toValue converts v to a protobuf Value via its JSON encoding.
+func toValue(v interface{}) (*structpb.Value, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(buf, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
+
+type watchServer struct {
+	clusters []*cluster
+}
+
+func (s *watchServer) listViolations() (*structpb.ListValue, error) {
+	ret := []publicService{}
+	for _, svc := range publicServices(s.clusters) {
+		if svc.Exempt == "" {
+			ret = append(ret, svc)
+		}
+	}
+	v, err := toValue(ret)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return v.GetListValue(), nil
+}
+
+func (s *watchServer) streamEvents(stream grpc.ServerStream) error {
+	ch := subscribers.subscribe()
+	defer subscribers.unsubscribe(ch)
+	for {
+		select {
+		case ev := <-ch:
+			v, err := toValue(ev)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err := stream.SendMsg(v.GetStructValue()); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-stopCh:
+			return status.Error(codes.Unavailable, "shutting down")
+		}
+	}
+}
+
+// watchServiceDesc is what protoc-gen-go-grpc would generate from
+// proto/watch.proto.
+var watchServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kubesvcwatch.v1.Watch",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListViolations",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(emptypb.Empty)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*watchServer).listViolations()
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/kubesvcwatch.v1.Watch/ListViolations",
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamEvents",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := new(emptypb.Empty)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(*watchServer).streamEvents(stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/watch.proto",
+}
+
+// grpcAuthenticate applies the same checks as authenticated().
+func grpcAuthenticate(ctx context.Context) error {
+	token := cfg().authToken
+	if token == "" && *tlsClientCAFile == "" {
+		return nil
+	}
+	if p, ok := peer.FromContext(ctx); ok && *tlsClientCAFile != "" {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			return nil
+		}
+	}
+	if token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, got := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) == 1 {
+				return nil
+			}
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+// newGRPCServer returns the gRPC API server, with the same TLS and
+// authentication settings as the HTTP endpoints.
+func newGRPCServer(clusters []*cluster) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := grpcAuthenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := grpcAuthenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+	if useTLS("grpc") {
+		config := &tls.Config{}
+		if *tlsClientCAFile != "" {
+			var err error
+			config, err = clientCertConfig(*tlsClientCAFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&watchServiceDesc, &watchServer{clusters: clusters})
+	return srv, nil
+}
+
+// serveGRPC serves the gRPC API on addr, sending any failure to
+// errs.
+func serveGRPC(srv *grpc.Server, addr string, errs chan<- error) {
+	lns, err := listen(addr)
+	if err != nil {
+		errs <- err
+		return
+	}
+	logInfo("Serving", "address", addr, "protocol", "grpc")
+	for _, l := range lns {
+		go func(l net.Listener) {
+			if err := srv.Serve(l); err != nil && err != grpc.ErrServerStopped {
+				errs <- err
+			}
+		}(l)
+	}
+}
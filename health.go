@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reflectors re-establish their watch at least every 10 minutes, so
+// one that hasn't talked to the apiserver for much longer is wedged.
+const reflectorStaleAfter = 30 * time.Minute
+
+var health = &healthState{
+	reflectors: make(map[string]*reflectorHealth),
+}
+
+type reflectorHealth struct {
+	listed   bool
+	watching bool
+	lastOK   time.Time
+}
+
+// healthState tracks what /healthz and /readyz report.
+type healthState struct {
+	mu         sync.Mutex
+	reflectors map[string]*reflectorHealth
+	exited     []string
+	// failing holds the errors of other checks that must pass
+	// before we're ready, by name.
+	failing map[string]error
+}
+
+func (h *healthState) reflector(name string) *reflectorHealth {
+	r, ok := h.reflectors[name]
+	if !ok {
+		r = &reflectorHealth{lastOK: time.Now()}
+		h.reflectors[name] = r
+	}
+	return r
+}
+
+// register adds a reflector that must sync before we're ready.
+func (h *healthState) register(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reflector(name)
+}
+
+func (h *healthState) listed(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.reflector(name)
+	r.listed = true
+	r.lastOK = time.Now()
+}
+
+func (h *healthState) watching(name string, watching bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.reflector(name)
+	r.watching = watching
+	if watching {
+		r.lastOK = time.Now()
+	}
+}
+
+// setFailing records the result of check name, with a nil err if it
+// passed.
+func (h *healthState) setFailing(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.failing, name)
+		return
+	}
+	if h.failing == nil {
+		h.failing = make(map[string]error)
+	}
+	h.failing[name] = err
+}
+
+// goLoop runs f in a new goroutine, marking us unhealthy if it
+// returns before we start shutting down.
+func goLoop(name string, f func()) {
+	go func() {
+		defer func() {
+			select {
+			case <-stopCh:
+				// We're shutting down.
+				return
+			default:
+			}
+			logError("Loop exited", "loop", name)
+			health.mu.Lock()
+			health.exited = append(health.exited, name)
+			health.mu.Unlock()
+		}()
+		f()
+	}()
+}
+
+// problems returns the reasons we aren't live, and if ready also the
+// reasons we aren't ready.
+func (h *healthState) problems(ready bool) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var ret []string
+	for _, name := range h.exited {
+		ret = append(ret, fmt.Sprintf("%s exited", name))
+	}
+	if ready {
+		for name, err := range h.failing {
+			ret = append(ret, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	for name, r := range h.reflectors {
+		if since := time.Since(r.lastOK); since > reflectorStaleAfter {
+			ret = append(ret, fmt.Sprintf("reflector %s last synced %s ago", name, since))
+		}
+		if !ready {
+			continue
+		}
+		if !r.listed {
+			ret = append(ret, fmt.Sprintf("reflector %s has not synced", name))
+		} else if !r.watching {
+			ret = append(ret, fmt.Sprintf("reflector %s is not watching", name))
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func healthHandler(ready bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if problems := health.problems(ready); len(problems) > 0 {
+			http.Error(w, strings.Join(problems, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
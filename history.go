@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+
+	"k8s.io/api/core/v1"
+)
+
+// recent holds the latest events, for the UI.
+var recent *history
+
+// history is a notifier that remembers the last few events.
+// Terminations are also saved to the state store, to be remembered
+// across restarts.
+type history struct {
+	size int
+
+	mu           sync.Mutex
+	events       []*event
+	terminations []*event
+}
+
+func newHistory(size int) *history {
+	return &history{size: size}
+}
+
+func (h *history) Name() string {
+	return "history"
+}
+
+func (h *history) Notify(ev *event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, ev)
+	if len(h.events) > h.size {
+		h.events = h.events[len(h.events)-h.size:]
+	}
+	if ev.Action == actionDeleted || ev.Action == actionIdleDeleted {
+		h.terminations = append(h.terminations, &event{
+			Time:      ev.Time,
+			Cluster:   ev.Cluster,
+			Action:    ev.Action,
+			Namespace: ev.Namespace,
+			Name:      ev.Name,
+			UID:       ev.UID,
+			Type:      ev.Type,
+			Reason:    ev.Reason,
+			Changes:   ev.Changes,
+		})
+		if len(h.terminations) > h.size {
+			h.terminations = h.terminations[len(h.terminations)-h.size:]
+		}
+		state.set("terminations", h.terminations)
+	}
+	return nil
+}
+
+// restore loads the terminations saved before we restarted.
+func (h *history) restore() error {
+	var terminations []*event
+	if err := state.get("terminations", &terminations); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.terminations = terminations
+	h.events = append(terminations[:len(terminations):len(terminations)], h.events...)
+	if len(h.events) > h.size {
+		h.events = h.events[len(h.events)-h.size:]
+	}
+	return nil
+}
+
+// terminatedBefore reports whether we've deleted an earlier incarnation
+// of svc, ie one with the same name but a different UID.
+func (h *history) terminatedBefore(cluster string, svc *v1.Service) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ev := range h.terminations {
+		if ev.Cluster == cluster && ev.Namespace == svc.Namespace && ev.Name == svc.Name && ev.UID != string(svc.UID) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the remembered events, newest first.
+func (h *history) list() []*event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make([]*event, len(h.events))
+	for i, ev := range h.events {
+		ret[len(ret)-1-i] = ev
+	}
+	return ret
+}
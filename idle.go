@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// How often to look for idle public services.
+const idleCheckInterval = time.Minute
+
+var idleSince = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kube_svc_watch_idle_public_service_since",
+		Help: "Unix time since when each public LoadBalancer service has selected no ready pods.",
+	},
+	[]string{"cluster", "namespace", "service"},
+)
+
+// idleDetector finds public LoadBalancer services whose selector
+// matches no ready pods.  They serve nothing, so are usually forgotten
+// leftovers: all attack surface and cost.
+type idleDetector struct {
+	endpoints cache.Store
+	synced    []cache.InformerSynced
+
+	// since holds when each idle service was first seen idle.
+	mu    sync.Mutex
+	since map[types.UID]time.Time
+}
+
+func newIdleDetector() *idleDetector {
+	return &idleDetector{since: make(map[types.UID]time.Time)}
+}
+
+// watch adds an Endpoints informer, which needs additional RBAC
+// permissions.
+func (d *idleDetector) watch(informer cache.SharedIndexInformer) {
+	if d.endpoints == nil {
+		d.endpoints = multiStore{}
+	}
+	d.endpoints = append(d.endpoints.(multiStore), informer.GetStore())
+	d.synced = append(d.synced, informer.HasSynced)
+}
+
+// isIdle reports whether svc is a public LoadBalancer without any
+// ready endpoints.  Services without a selector have their endpoints
+// managed by hand, so are never idle.
+func (d *idleDetector) isIdle(svc *v1.Service) bool {
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer || !isExposed(svc) || len(svc.Spec.Selector) == 0 {
+		return false
+	}
+	obj, exists, err := d.endpoints.GetByKey(svc.Namespace + "/" + svc.Name)
+	if err != nil {
+		return false
+	}
+	if !exists {
+		return true
+	}
+	for _, subset := range obj.(*v1.Endpoints).Subsets {
+		if len(subset.Addresses) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// run checks c's services every idleCheckInterval, until we stop.
+// Those idle for longer than -delete-idle-loadbalancers-after are
+// queued for the terminator to delete.
+func (d *idleDetector) run(c *cluster) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+		synced := true
+		for _, s := range d.synced {
+			synced = synced && s()
+		}
+		if !synced {
+			continue
+		}
+		d.checkAll(c)
+	}
+}
+
+func (d *idleDetector) checkAll(c *cluster) {
+	now := time.Now()
+	idleSince.DeletePartialMatch(prometheus.Labels{"cluster": c.name})
+	since := make(map[types.UID]time.Time)
+	d.mu.Lock()
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if !d.isIdle(svc) {
+			continue
+		}
+		t, ok := d.since[svc.UID]
+		if !ok {
+			t = now
+		}
+		since[svc.UID] = t
+		idleSince.WithLabelValues(c.name, svc.Namespace, svc.Name).Set(float64(t.Unix()))
+	}
+	d.since = since
+	d.mu.Unlock()
+
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if _, due := d.due(svc); due {
+			c.queue.Add(svcKey(svc))
+		}
+	}
+}
+
+// due reports whether svc has been idle for long enough to delete, and
+// for how long.  Exempt services are left alone unless
+// -delete-idle-exempt-loadbalancers.
+func (d *idleDetector) due(svc *v1.Service) (time.Duration, bool) {
+	if d == nil || *idleDeleteAfter <= 0 {
+		return 0, false
+	}
+	if exemptReason(svc) != "" && !*idleDeleteExempt {
+		return 0, false
+	}
+	d.mu.Lock()
+	t, ok := d.since[svc.UID]
+	d.mu.Unlock()
+	if !ok || !d.isIdle(svc) {
+		return 0, false
+	}
+	idleFor := time.Since(t)
+	return idleFor, idleFor >= *idleDeleteAfter
+}
+
+// deleteIdle deletes svc if it is still idle, returning the deleted
+// service, or nil if it has changed or is already gone.
+func (d *idleDetector) deleteIdle(c *cluster, svc *v1.Service) (*v1.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	live, err := c.client.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if live.UID != svc.UID || !d.isIdle(live) || (exemptReason(live) != "" && !*idleDeleteExempt) {
+		return nil, nil
+	}
+	err = c.deleter.CoreV1().Services(svc.Namespace).Delete(ctx, svc.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &live.UID,
+			ResourceVersion: &live.ResourceVersion,
+		},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return live, nil
+}
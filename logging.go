@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// logger writes one structured record per line, as logfmt or JSON.
+// Use consistent keys (namespace, service, action, backend, error)
+// so log pipelines can match on them.
+var logger = &structLogger{out: os.Stderr, level: levelInfo}
+
+type structLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level int
+	json  bool
+}
+
+// parseLogSettings parses -log-level and -log-format.
+func parseLogSettings(level, format string) (int, bool, error) {
+	l := -1
+	for i, name := range levelNames {
+		if name == level {
+			l = i
+		}
+	}
+	if l < 0 {
+		return 0, false, fmt.Errorf("unknown log level %q", level)
+	}
+
+	switch format {
+	case "text":
+		return l, false, nil
+	case "json":
+		return l, true, nil
+	}
+	return 0, false, fmt.Errorf("unknown log format %q", format)
+}
+
+// configure sets the minimum level to log, and the format.
+func (l *structLogger) configure(level int, asJSON bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+	l.json = asJSON
+}
+
+func logDebug(msg string, kv ...interface{}) { logger.log(levelDebug, msg, kv) }
+func logInfo(msg string, kv ...interface{})  { logger.log(levelInfo, msg, kv) }
+func logWarn(msg string, kv ...interface{})  { logger.log(levelWarn, msg, kv) }
+func logError(msg string, kv ...interface{}) { logger.log(levelError, msg, kv) }
+
+// pkgLogger passes on the logs of the packages under pkg/.
+type pkgLogger struct{}
+
+func (pkgLogger) Warn(msg string, kv ...interface{})  { logWarn(msg, kv...) }
+func (pkgLogger) Error(msg string, kv ...interface{}) { logError(msg, kv...) }
+
+// logFatal logs at error level and exits.
+func logFatal(msg string, kv ...interface{}) {
+	logger.log(levelError, msg, kv)
+	os.Exit(1)
+}
+
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func (l *structLogger) log(level int, msg string, kv []interface{}) {
+	l.mu.Lock()
+	minLevel, asJSON := l.level, l.json
+	l.mu.Unlock()
+	if level < minLevel {
+		return
+	}
+	keys := []string{"time", "level", "msg"}
+	values := []interface{}{time.Now().UTC().Format(time.RFC3339Nano), levelNames[level], msg}
+	for i := 0; i+1 < len(kv); i += 2 {
+		keys = append(keys, fmt.Sprint(kv[i]))
+		values = append(values, logValue(kv[i+1]))
+	}
+
+	var buf bytes.Buffer
+	if asJSON {
+		// Built by hand to keep the keys in order.
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			kj, _ := json.Marshal(k)
+			vj, err := json.Marshal(values[i])
+			if err != nil {
+				vj, _ = json.Marshal(fmt.Sprint(values[i]))
+			}
+			buf.Write(kj)
+			buf.WriteByte(':')
+			buf.Write(vj)
+		}
+		buf.WriteByte('}')
+	} else {
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			v := fmt.Sprint(values[i])
+			if v == "" || strings.ContainsAny(v, " \"=\t\n") {
+				v = strconv.Quote(v)
+			}
+			fmt.Fprintf(&buf, "%s=%s", k, v)
+		}
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"github.com/anguslees/kube-svc-watch/pkg/policy"
+	"k8s.io/api/core/v1"
+)
+
+// metricsSource exports a cluster's services through
+// metrics.ServiceCollector.
+type metricsSource struct {
+	cluster *cluster
+}
+
+func newSvcCollector(c *cluster) *metrics.ServiceCollector {
+	return metrics.NewServiceCollector(metricsSource{c}, metrics.ServiceOptions{
+		InfoLabels:       splitList(*metricLabels),
+		Labels:           splitList(*labelsMetric),
+		Annotations:      splitList(*annotationsMetric),
+		AnnotationMaxLen: *annotationsMaxLen,
+	})
+}
+
+func (s metricsSource) Services() []*v1.Service {
+	items := s.cluster.store.List()
+	ret := make([]*v1.Service, 0, len(items))
+	for _, item := range items {
+		ret = append(ret, item.(*v1.Service))
+	}
+	return ret
+}
+
+func (s metricsSource) Policy() policy.Policy {
+	return rules()
+}
+
+func (s metricsSource) Severity(svc *v1.Service) float64 {
+	return s.cluster.severity(svc)
+}
+
+func (s metricsSource) Pending(svc *v1.Service) bool {
+	return isLbPending(svc)
+}
+
+func (s metricsSource) HourlyCost(svc *v1.Service) (float64, bool) {
+	return lbHourlyCost(svc)
+}
+
+func (s metricsSource) NamespaceCosts() map[string]metrics.NamespaceCost {
+	if cfg().lbPrices == nil {
+		return nil
+	}
+	ret := make(map[string]metrics.NamespaceCost)
+	for ns, nc := range s.cluster.namespaceCosts() {
+		ret[ns] = metrics.NamespaceCost{
+			External:           nc.External,
+			Internal:           nc.Internal,
+			ExternalHourlyCost: nc.ExternalHourlyCost,
+			InternalHourlyCost: nc.InternalHourlyCost,
+		}
+	}
+	return ret
+}
+
+func (s metricsSource) Duplicates() map[metrics.Selector][]string {
+	ret := make(map[metrics.Selector][]string)
+	for key, names := range duplicateLoadBalancers(s.cluster.store) {
+		ret[metrics.Selector{Namespace: key.namespace, Selector: key.selector}] = names
+	}
+	return ret
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	nodePublicIP = prometheus.NewDesc(
+		"kube_node_public_ip",
+		"Publicly routable addresses of cluster nodes.",
+		[]string{"node", "address"}, nil,
+	)
+	publicNodePorts = prometheus.NewDesc(
+		"kube_svc_watch_public_nodeport_services",
+		"Number of NodePort services in each namespace reachable via a publicly addressed node.",
+		[]string{"namespace"}, nil,
+	)
+)
+
+// privateNets are the ranges that aren't routable on the internet.
+var privateNets = func() []*net.IPNet {
+	var ret []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10", // carrier-grade NAT
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"fc00::/7",
+		"fe80::/10",
+		"::1/128",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}()
+
+func isPublicIP(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func nodePublicIPs(node *v1.Node) []string {
+	var ret []string
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != v1.NodeExternalIP && addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		if isPublicIP(addr.Address) {
+			ret = append(ret, addr.Address)
+		}
+	}
+	return ret
+}
+
+// nodeCollector reports nodes with public addresses, and the
+// NodePort services they expose.
+type nodeCollector struct {
+	svcs  cache.Store
+	nodes cache.Store
+}
+
+// newNodeCollector starts watching Nodes, which needs additional RBAC
+// permissions.
+func newNodeCollector(c *cluster) nodeCollector {
+	nodes := c.informerFor(c.factory, metav1.NamespaceAll, "nodes", &v1.Node{}, nil, nil).GetStore()
+	return nodeCollector{svcs: c.store, nodes: nodes}
+}
+
+func (c nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodePublicIP
+	ch <- publicNodePorts
+}
+
+func (c nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	anyPublic := false
+	for _, item := range c.nodes.List() {
+		node := item.(*v1.Node)
+		for _, ip := range nodePublicIPs(node) {
+			anyPublic = true
+			ch <- prometheus.MustNewConstMetric(nodePublicIP,
+				prometheus.GaugeValue, 1, node.Name, ip)
+		}
+	}
+
+	// Every node listens on every NodePort, so one public node is
+	// enough.
+	counts := make(map[string]int)
+	for _, item := range c.svcs.List() {
+		svc := item.(*v1.Service)
+		n := counts[svc.Namespace]
+		if anyPublic && svc.Spec.Type == v1.ServiceTypeNodePort {
+			n++
+		}
+		counts[svc.Namespace] = n
+	}
+	for ns, n := range counts {
+		ch <- prometheus.MustNewConstMetric(publicNodePorts,
+			prometheus.GaugeValue, float64(n), ns)
+	}
+}
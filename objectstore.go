@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectStore is a bucket of S3 or GCS objects.
+type objectStore interface {
+	put(key, contentType string, body []byte) error
+	list(prefix string) ([]storedObject, error)
+	delete(key string) error
+}
+
+type storedObject struct {
+	key      string
+	modified time.Time
+}
+
+// newObjectStore returns the store for a s3://bucket/prefix or
+// gs://bucket/prefix URL, and the prefix.
+func newObjectStore(rawurl string) (objectStore, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("no bucket in %q", rawurl)
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	switch u.Scheme {
+	case "s3":
+		s, err := newS3Store(u.Host)
+		return s, prefix, err
+	case "gs":
+		return &gcsStore{bucket: u.Host, tokens: &metadataToken{}}, prefix, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported object store URL %q: want s3:// or gs://", rawurl)
+	}
+}
+
+// doStore makes a request to an object store, returning the response
+// body.
+func doStore(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+const gcsURL = "https://storage.googleapis.com"
+
+// gcsStore uses the GCS JSON API, with the credentials of the
+// metadata server's service account.
+type gcsStore struct {
+	bucket string
+	tokens *metadataToken
+}
+
+func (s *gcsStore) do(method, rawurl, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, rawurl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.tokens.get()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return doStore(req)
+}
+
+func (s *gcsStore) put(key, contentType string, body []byte) error {
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", gcsURL, url.PathEscape(s.bucket), url.QueryEscape(key))
+	_, err := s.do("POST", u, contentType, body)
+	return err
+}
+
+func (s *gcsStore) list(prefix string) ([]storedObject, error) {
+	var ret []storedObject
+	pageToken := ""
+	for {
+		q := url.Values{"prefix": {prefix}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		body, err := s.do("GET", fmt.Sprintf("%s/storage/v1/b/%s/o?%s", gcsURL, url.PathEscape(s.bucket), q.Encode()), "", nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name        string    `json:"name"`
+				TimeCreated time.Time `json:"timeCreated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			ret = append(ret, storedObject{item.Name, item.TimeCreated})
+		}
+		if page.NextPageToken == "" {
+			return ret, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (s *gcsStore) delete(key string) error {
+	_, err := s.do("DELETE", fmt.Sprintf("%s/storage/v1/b/%s/o/%s", gcsURL, url.PathEscape(s.bucket), url.PathEscape(key)), "", nil)
+	return err
+}
+
+// s3Store uses the S3 REST API, signed with the static credentials in
+// the standard AWS_* environment variables.  AWS_ENDPOINT_URL_S3 may
+// name an S3-compatible service, which is addressed path-style.
+type s3Store struct {
+	bucket   string
+	region   string
+	endpoint string
+	pathing  bool
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newS3Store(bucket string) (*s3Store, error) {
+	s := &s3Store{
+		bucket:       bucket,
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("s3:// needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_S3"); endpoint != "" {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+		s.pathing = true
+	} else {
+		s.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, s.region)
+	}
+	return s, nil
+}
+
+func (s *s3Store) do(method, key string, query url.Values, contentType string, body []byte) ([]byte, error) {
+	path := "/" + key
+	if s.pathing {
+		path = "/" + s.bucket + path
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawPath = awsEscapePath(path)
+	u.RawQuery = awsCanonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+	return doStore(req)
+}
+
+func (s *s3Store) put(key, contentType string, body []byte) error {
+	_, err := s.do("PUT", key, nil, contentType, body)
+	return err
+}
+
+func (s *s3Store) list(prefix string) ([]storedObject, error) {
+	var ret []storedObject
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		body, err := s.do("GET", "", q, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, c := range page.Contents {
+			ret = append(ret, storedObject{c.Key, c.LastModified})
+		}
+		if !page.IsTruncated {
+			return ret, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *s3Store) delete(key string) error {
+	_, err := s.do("DELETE", key, nil, "", nil)
+	return err
+}
+
+// sign adds an AWS Signature Version 4 to req.
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but unreserved characters, as
+// signing requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsCanonicalQuery encodes query sorted by key, as signing requires.
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
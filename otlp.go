@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// This speaks OTLP/HTTP with the JSON encoding, which every
+// OpenTelemetry collector accepts, so we don't need the (large) SDK.
+
+const otlpCumulative = 2 // AGGREGATION_TEMPORALITY_CUMULATIVE
+
+var processStart = time.Now()
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttrs(kv ...string) []otlpKeyValue {
+	attrs := make([]otlpKeyValue, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		var a otlpKeyValue
+		a.Key = kv[i]
+		a.Value.StringValue = kv[i+1]
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+func otlpResource() map[string]interface{} {
+	return map[string]interface{}{
+		"attributes": otlpAttrs(
+			"service.name", "kube-svc-watch",
+			"k8s.cluster.name", *clusterName,
+		),
+	}
+}
+
+// otlpTime formats t as the decimal string form of a fixed64, per
+// the protobuf JSON mapping.
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpPost(endpoint, signal string, body interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(endpoint, "/") + "/v1/" + signal
+	_, err = postJSON(url, "application/json", bytes.NewReader(buf), nil)
+	return err
+}
+
+// runOTLPMetrics periodically pushes everything in the Prometheus
+// registry to an OTLP collector.
+func runOTLPMetrics(endpoint string, interval time.Duration, gatherer prometheus.Gatherer) {
+	for range time.Tick(interval) {
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			logError("Error gathering metrics", "backend", "otlp", "error", err)
+			continue
+		}
+		err = otlpPost(endpoint, "metrics", map[string]interface{}{
+			"resourceMetrics": []interface{}{
+				map[string]interface{}{
+					"resource": otlpResource(),
+					"scopeMetrics": []interface{}{
+						map[string]interface{}{
+							"scope":   map[string]string{"name": "kube-svc-watch"},
+							"metrics": otlpMetrics(mfs, time.Now()),
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			logError("Error pushing metrics", "backend", "otlp", "endpoint", endpoint, "error", err)
+		}
+	}
+}
+
+func otlpMetrics(mfs []*dto.MetricFamily, now time.Time) []interface{} {
+	ret := make([]interface{}, 0, len(mfs))
+	for _, mf := range mfs {
+		points := make([]map[string]interface{}, 0, len(mf.GetMetric()))
+		for _, m := range mf.GetMetric() {
+			kv := make([]string, 0, 2*len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				kv = append(kv, l.GetName(), l.GetValue())
+			}
+			p := map[string]interface{}{
+				"attributes":        otlpAttrs(kv...),
+				"startTimeUnixNano": otlpTime(processStart),
+				"timeUnixNano":      otlpTime(now),
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				p["asDouble"] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				p["asDouble"] = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				p["asDouble"] = m.GetUntyped().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				var bounds []float64
+				var counts []string
+				var prev uint64
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						continue
+					}
+					bounds = append(bounds, b.GetUpperBound())
+					counts = append(counts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+					prev = b.GetCumulativeCount()
+				}
+				counts = append(counts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+				p["count"] = strconv.FormatUint(h.GetSampleCount(), 10)
+				p["sum"] = h.GetSampleSum()
+				p["explicitBounds"] = bounds
+				p["bucketCounts"] = counts
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				var quantiles []map[string]float64
+				for _, q := range s.GetQuantile() {
+					quantiles = append(quantiles, map[string]float64{
+						"quantile": q.GetQuantile(),
+						"value":    q.GetValue(),
+					})
+				}
+				p["count"] = strconv.FormatUint(s.GetSampleCount(), 10)
+				p["sum"] = s.GetSampleSum()
+				p["quantileValues"] = quantiles
+			}
+			points = append(points, p)
+		}
+
+		metric := map[string]interface{}{
+			"name":        mf.GetName(),
+			"description": mf.GetHelp(),
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			metric["sum"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": otlpCumulative,
+				"isMonotonic":            true,
+			}
+		case dto.MetricType_HISTOGRAM:
+			metric["histogram"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": otlpCumulative,
+			}
+		case dto.MetricType_SUMMARY:
+			metric["summary"] = map[string]interface{}{
+				"dataPoints": points,
+			}
+		default:
+			metric["gauge"] = map[string]interface{}{
+				"dataPoints": points,
+			}
+		}
+		ret = append(ret, metric)
+	}
+	return ret
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// httpClient is for notifications and other outbound requests,
+// rather than requests to the apiserver.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// setupHTTPClient configures httpClient, and the Slack client, to use
+// -notify-proxy, or else the proxy from HTTPS_PROXY or HTTP_PROXY.
+// NO_PROXY applies either way.  Servers may also be verified with
+// -notify-ca-file, and we may authenticate with -notify-cert-file.
+func setupHTTPClient() error {
+	proxy := httpproxy.FromEnvironment()
+	if *notifyProxy != "" {
+		if _, err := url.Parse(*notifyProxy); err != nil {
+			return err
+		}
+		proxy.HTTPProxy = *notifyProxy
+		proxy.HTTPSProxy = *notifyProxy
+	}
+	proxyFunc := proxy.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	config, err := outboundTLSConfig()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig = config
+	httpClient.Transport = transport
+	slack.HTTPClient = httpClient
+	return nil
+}
+
+// outboundTLSConfig trusts the CAs in -notify-ca-file as well as the
+// system's, so that both public services and internal receivers with
+// a private PKI can be used.
+func outboundTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if *notifyCAFile != "" {
+		pem, err := ioutil.ReadFile(*notifyCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *notifyCAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (*notifyCertFile == "") != (*notifyKeyFile == "") {
+		return nil, fmt.Errorf("-notify-cert-file and -notify-key-file must be used together")
+	}
+	if *notifyCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(*notifyCertFile, *notifyKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// splitList splits a comma-separated flag value, dropping empty
+// elements.
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// stringList is a flag that may be repeated, or given a
+// comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, splitList(s)...)
+	return nil
+}
+
+// parseFloatMap parses a comma-separated list of key=value, where
+// each value is a number.
+func parseFloatMap(s string) (map[string]float64, error) {
+	ret := make(map[string]float64)
+	for _, kv := range splitList(s) {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", kv)
+		}
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value for %s: %s", parts[0], err)
+		}
+		ret[parts[0]] = v
+	}
+	return ret, nil
+}
+
+// namespaceValue returns the value of the first of keys found on
+// the namespace, looking at annotations before labels.
+func (c *cluster) namespaceValue(namespace string, keys []string) string {
+	store := c.namespaceStore()
+	if store == nil || len(keys) == 0 {
+		return ""
+	}
+	obj, exists, err := store.GetByKey(namespace)
+	if err != nil || !exists {
+		return ""
+	}
+	ns := obj.(*v1.Namespace)
+	for _, k := range keys {
+		if v := ns.Annotations[k]; v != "" {
+			return v
+		}
+		if v := ns.Labels[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c *cluster) lookupOwner(namespace string) (owner, slackChannel string) {
+	st := cfg()
+	return c.namespaceValue(namespace, st.ownerKeys),
+		c.namespaceValue(namespace, st.ownerSlackKeys)
+}
+
+// lookupCreator returns the email address of whoever created svc, as
+// recorded in the Service or its Namespace annotations.
+//
+// Note managedFields only names the client (eg kubectl), not the
+// user, so there's no attribution available from the object itself.
+func (c *cluster) lookupCreator(svc *v1.Service) string {
+	keys := cfg().creatorKeys
+	for _, k := range keys {
+		if v := svc.Annotations[k]; v != "" {
+			return v
+		}
+	}
+	return c.namespaceValue(svc.Namespace, keys)
+}
+
+// lookupOwnerEmail returns the email addresses of svc's owners, from
+// the Service or its Namespace annotations.
+func (c *cluster) lookupOwnerEmail(svc *v1.Service) []string {
+	keys := cfg().ownerEmailKeys
+	for _, k := range keys {
+		if v := svc.Annotations[k]; v != "" {
+			return splitList(v)
+		}
+	}
+	return splitList(c.namespaceValue(svc.Namespace, keys))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pause is whether enforcement is paused, for incident response or
+// maintenance.  Public services are still notified while paused, and
+// deleted once enforcement resumes.
+var pause = &pauser{}
+
+type pauser struct {
+	mu    sync.Mutex
+	until time.Time
+	timer *time.Timer
+}
+
+// forever is how long an indefinite pause lasts.
+const forever = 100 * 365 * 24 * time.Hour
+
+func (p *pauser) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().Before(p.until)
+}
+
+// pausedUntil returns when enforcement resumes, or the zero time if it
+// isn't paused.
+func (p *pauser) pausedUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(p.until) {
+		return p.until
+	}
+	return time.Time{}
+}
+
+// set pauses enforcement for d, or indefinitely if d is 0.  by says
+// who asked, for the log.
+func (p *pauser) set(d time.Duration, by string) {
+	if d <= 0 {
+		d = forever
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until = time.Now().Add(d)
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(d, func() { p.resume("timeout") })
+	if d == forever {
+		logWarn("Enforcement paused", "by", by)
+	} else {
+		logWarn("Enforcement paused", "by", by, "until", p.until.UTC().Format(time.RFC3339))
+	}
+}
+
+// resume resumes enforcement, if it was paused.
+func (p *pauser) resume(by string) {
+	p.mu.Lock()
+	if p.until.IsZero() {
+		p.mu.Unlock()
+		return
+	}
+	p.until = time.Time{}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.mu.Unlock()
+	logInfo("Enforcement resumed", "by", by)
+	requeueClusters()
+}
+
+var pausedGauge = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "kube_svc_watch_paused",
+		Help: "Whether enforcement is paused (1) or not (0).",
+	},
+	func() float64 {
+		if pause.paused() {
+			return 1
+		}
+		return 0
+	},
+)
+
+// handlePause registers /admin/pause, which pauses enforcement on POST
+// (for ?duration=, or until resumed) and reports the pause on GET, and
+// /admin/resume.
+func handlePause(ls listeners, addr string) {
+	ls.handle(addr, "/admin/pause", controlAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "POST":
+			var d time.Duration
+			if s := r.URL.Query().Get("duration"); s != "" {
+				var err error
+				if d, err = time.ParseDuration(s); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			pause.set(d, "admin:"+r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writePauseState(w)
+	})))
+	ls.handle(addr, "/admin/resume", controlAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pause.resume("admin:" + r.RemoteAddr)
+		writePauseState(w)
+	})))
+}
+
+func writePauseState(w http.ResponseWriter) {
+	state := struct {
+		Paused bool       `json:"paused"`
+		Until  *time.Time `json:"until,omitempty"`
+	}{}
+	if until := pause.pausedUntil(); !until.IsZero() {
+		state.Paused = true
+		if until.Sub(time.Now()) < forever/2 {
+			until = until.UTC()
+			state.Until = &until
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
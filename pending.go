@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// isLbPending reports whether svc has been waiting for its load
+// balancer for longer than -loadbalancer-pending-after.
+//
+// There's no record of when a service became a LoadBalancer, so
+// this measures from creation.
+func isLbPending(svc *v1.Service) bool {
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer || len(svc.Status.LoadBalancer.Ingress) > 0 {
+		return false
+	}
+	return time.Since(svc.CreationTimestamp.Time) > *lbPendingAfter
+}
+
+// notifyPending periodically sends a notification for each service
+// that has become pending, once.
+func notifyPending(c *cluster, notify *liveNotifiers) {
+	notified := make(map[types.UID]bool)
+	for range time.Tick(time.Minute) {
+		pending := make(map[types.UID]bool)
+		for _, item := range c.store.List() {
+			svc := item.(*v1.Service)
+			if !isLbPending(svc) {
+				continue
+			}
+			pending[svc.UID] = true
+			if !notified[svc.UID] {
+				notify.notify(newEvent(c, actionLbPending, svc), nil)
+			}
+		}
+		notified = pending
+	}
+}
@@ -0,0 +1,89 @@
+// Package detect classifies Kubernetes Services as internal or
+// public, so other controllers can apply the same rules as
+// kube-svc-watch.
+package detect
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// Cloud providers, which differ in how a LoadBalancer is made
+// internal.
+const (
+	ProviderAWS = "aws"
+	ProviderGCP = "gcp"
+)
+
+const (
+	AWSLbInternal      = "service.beta.kubernetes.io/aws-load-balancer-internal"
+	AWSLbInternalValue = "0.0.0.0/0"
+	GCPLbInternal      = "cloud.google.com/load-balancer-type"
+	GCPLbInternalValue = "internal"
+)
+
+// Reasons a Service is considered public.
+const (
+	ReasonMissingAnnotation      = "missing-internal-annotation"
+	ReasonWrongAnnotation        = "unrecognised-internal-annotation"
+	ReasonOpenSourceRanges       = "open-source-ranges"
+	ReasonRestrictedSourceRanges = "restricted-source-ranges"
+
+	// ReasonNotApproved is for internal LoadBalancer services
+	// that a default-deny policy (see pkg/policy) treats as
+	// public.  ExternalReason never returns it.
+	ReasonNotApproved = "not-approved"
+)
+
+// Public services with this annotation are left alone.  The value
+// should explain why.
+const ExemptAnnotation = "kube-svc-watch/exempt"
+
+// ExternalReason returns why svc is considered public on provider,
+// or "" if it is internal.
+func ExternalReason(provider string, svc *v1.Service) string {
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return ""
+	}
+	annotation, value := AWSLbInternal, AWSLbInternalValue
+	if provider == ProviderGCP {
+		annotation, value = GCPLbInternal, GCPLbInternalValue
+	}
+	actual, ok := svc.Annotations[annotation]
+	if actual == value {
+		return ""
+	}
+
+	// Everything below is external; the rest is just explaining
+	// why.
+	if ok {
+		return ReasonWrongAnnotation
+	}
+	for _, r := range svc.Spec.LoadBalancerSourceRanges {
+		if r == "0.0.0.0/0" || r == "::/0" {
+			return ReasonOpenSourceRanges
+		}
+	}
+	if len(svc.Spec.LoadBalancerSourceRanges) > 0 {
+		return ReasonRestrictedSourceRanges
+	}
+	return ReasonMissingAnnotation
+}
+
+// IsInternal reports whether svc is only reachable from inside the
+// cluster's network on provider: it isn't a LoadBalancer, or it has
+// that provider's internal load balancer annotation.
+func IsInternal(provider string, svc *v1.Service) bool {
+	return ExternalReason(provider, svc) == ""
+}
+
+// ExemptReason returns why svc is allowed to be public, or "" if it
+// isn't exempt.
+func ExemptReason(svc *v1.Service) string {
+	return svc.Annotations[ExemptAnnotation]
+}
+
+// IsViolation reports whether svc is public on provider without an
+// exemption.
+func IsViolation(provider string, svc *v1.Service) bool {
+	return !IsInternal(provider, svc) && ExemptReason(svc) == ""
+}
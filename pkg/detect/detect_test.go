@@ -0,0 +1,132 @@
+package detect
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func service(typ v1.ServiceType, annotations map[string]string, ranges ...string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "svc",
+			Annotations: annotations,
+		},
+		Spec: v1.ServiceSpec{
+			Type:                     typ,
+			LoadBalancerSourceRanges: ranges,
+		},
+	}
+}
+
+func TestExternalReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		svc      *v1.Service
+		want     string
+	}{
+		{
+			name:     "cluster IP",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeClusterIP, nil),
+			want:     "",
+		},
+		{
+			name:     "node port",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeNodePort, nil),
+			want:     "",
+		},
+		{
+			name:     "aws internal",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, map[string]string{AWSLbInternal: AWSLbInternalValue}),
+			want:     "",
+		},
+		{
+			name:     "gcp internal",
+			provider: ProviderGCP,
+			svc:      service(v1.ServiceTypeLoadBalancer, map[string]string{GCPLbInternal: GCPLbInternalValue}),
+			want:     "",
+		},
+		{
+			name:     "aws annotation on gcp",
+			provider: ProviderGCP,
+			svc:      service(v1.ServiceTypeLoadBalancer, map[string]string{AWSLbInternal: AWSLbInternalValue}),
+			want:     ReasonMissingAnnotation,
+		},
+		{
+			name:     "missing annotation",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, nil),
+			want:     ReasonMissingAnnotation,
+		},
+		{
+			name:     "wrong annotation value",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, map[string]string{AWSLbInternal: "true"}),
+			want:     ReasonWrongAnnotation,
+		},
+		{
+			name:     "wrong annotation beats source ranges",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, map[string]string{AWSLbInternal: "true"}, "0.0.0.0/0"),
+			want:     ReasonWrongAnnotation,
+		},
+		{
+			name:     "open ipv4 source range",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, nil, "10.0.0.0/8", "0.0.0.0/0"),
+			want:     ReasonOpenSourceRanges,
+		},
+		{
+			name:     "open ipv6 source range",
+			provider: ProviderGCP,
+			svc:      service(v1.ServiceTypeLoadBalancer, nil, "::/0"),
+			want:     ReasonOpenSourceRanges,
+		},
+		{
+			name:     "restricted source ranges",
+			provider: ProviderAWS,
+			svc:      service(v1.ServiceTypeLoadBalancer, nil, "10.0.0.0/8"),
+			want:     ReasonRestrictedSourceRanges,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ExternalReason(test.provider, test.svc)
+			if got != test.want {
+				t.Errorf("ExternalReason() = %q, want %q", got, test.want)
+			}
+			if internal := IsInternal(test.provider, test.svc); internal != (test.want == "") {
+				t.Errorf("IsInternal() = %v, want %v", internal, test.want == "")
+			}
+		})
+	}
+}
+
+func TestIsViolation(t *testing.T) {
+	public := service(v1.ServiceTypeLoadBalancer, nil)
+	if !IsViolation(ProviderAWS, public) {
+		t.Errorf("public service isn't a violation")
+	}
+	if ExemptReason(public) != "" {
+		t.Errorf("ExemptReason() = %q for a service without an exemption", ExemptReason(public))
+	}
+
+	exempt := service(v1.ServiceTypeLoadBalancer, map[string]string{ExemptAnnotation: "public website"})
+	if IsViolation(ProviderAWS, exempt) {
+		t.Errorf("exempt service is a violation")
+	}
+	if got := ExemptReason(exempt); got != "public website" {
+		t.Errorf("ExemptReason() = %q, want %q", got, "public website")
+	}
+
+	internal := service(v1.ServiceTypeLoadBalancer, map[string]string{AWSLbInternal: AWSLbInternalValue})
+	if IsViolation(ProviderAWS, internal) {
+		t.Errorf("internal service is a violation")
+	}
+}
@@ -0,0 +1,149 @@
+// Package metrics holds kube-svc-watch's Prometheus metrics: counters
+// and gauges of what it has done, and a collector describing the
+// Services it watches.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	TerminationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_terminations_total",
+			Help: "Number of public services deleted.",
+		},
+		[]string{"cluster", "namespace", "reason"},
+	)
+	RepeatOffensesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_repeat_offenses_total",
+			Help: "Number of times a service was made public again, by name, after we deleted it.",
+		},
+		[]string{"cluster", "namespace"},
+	)
+	DeleteErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_delete_errors_total",
+			Help: "Number of failed attempts to delete a public service.",
+		},
+		[]string{"cluster", "namespace", "reason"},
+	)
+	DeleteRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_delete_retries_total",
+			Help: "Number of failed deletes that were retried.",
+		},
+		[]string{"cluster"},
+	)
+	ParkedServices = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_parked_services",
+			Help: "Number of public services that couldn't be deleted after -delete-max-retries, and won't be retried until they change.",
+		},
+		[]string{"cluster"},
+	)
+	RemediationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kube_svc_watch_remediation_seconds",
+			Help:    "Time from a public service first being observed to it being remediated.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 11),
+		},
+		[]string{"cluster", "action"},
+	)
+	WatchErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_watch_errors_total",
+			Help: "Number of failed list or watch requests, and watch error events.",
+		},
+		[]string{"cluster", "reflector"},
+	)
+	LastSync = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_last_sync_timestamp_seconds",
+			Help: "Time of the last successful list, watch or watch event.",
+		},
+		[]string{"cluster", "reflector"},
+	)
+	LastListRV = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_last_list_resourceversion",
+			Help: "resourceVersion of the last successful list.",
+		},
+		[]string{"cluster", "reflector"},
+	)
+	NotificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_svc_watch_notifications_total",
+			Help: "Number of notifications by backend and outcome (delivered, failed or dropped). Their sum is the number attempted.",
+		},
+		[]string{"backend", "outcome"},
+	)
+	LastDeleteError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_last_delete_error_timestamp_seconds",
+			Help: "Time of the last failed attempt to delete a public service.",
+		},
+		[]string{"cluster"},
+	)
+	EnforcementActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_enforcement_active",
+			Help: "Whether public services are being deleted (1), or only monitored (0).",
+		},
+		[]string{"cluster"},
+	)
+	AccessAllowed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kube_svc_watch_access_allowed",
+			Help: "Whether the startup access review allowed each verb on services (1) or not (0).",
+		},
+		[]string{"cluster", "verb"},
+	)
+)
+
+// Collectors returns the metrics above, to be registered.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		TerminationsTotal,
+		RepeatOffensesTotal,
+		DeleteErrorsTotal,
+		DeleteRetriesTotal,
+		ParkedServices,
+		RemediationSeconds,
+		WatchErrorsTotal,
+		LastSync,
+		LastListRV,
+		NotificationsTotal,
+		LastDeleteError,
+		EnforcementActive,
+		AccessAllowed,
+	}
+}
+
+// CountNotifications counts n notifications to backend as delivered,
+// or failed if err is set.
+func CountNotifications(backend string, n int, err error) {
+	outcome := "delivered"
+	if err != nil {
+		outcome = "failed"
+	}
+	NotificationsTotal.WithLabelValues(backend, outcome).Add(float64(n))
+}
+
+// CountDropped counts a notification to backend that was dropped
+// without an attempt to deliver it.
+func CountDropped(backend string) {
+	NotificationsTotal.WithLabelValues(backend, "dropped").Inc()
+}
+
+// ErrorReason summarises err as a low-cardinality metric label.
+func ErrorReason(err error) string {
+	if status, ok := err.(errors.APIStatus); ok {
+		if reason := status.Status().Reason; reason != "" {
+			return string(reason)
+		}
+	}
+	return "Unknown"
+}
@@ -0,0 +1,440 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anguslees/kube-svc-watch/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+)
+
+var (
+	lbAddress = prometheus.NewDesc(
+		"kube_service_loadbalancer_address",
+		"Addresses assigned to LoadBalancer services.",
+		[]string{
+			"kubernetes_namespace",
+			"kubernetes_name",
+			"ip",
+			"hostname",
+		}, nil,
+	)
+	svcPorts = prometheus.NewDesc(
+		"kube_service_ports",
+		"Ports exposed by cluster services.",
+		[]string{
+			"kubernetes_namespace",
+			"kubernetes_name",
+			"port_name",
+			"port",
+			"protocol",
+			"node_port",
+		}, nil,
+	)
+	svcCreated = prometheus.NewDesc(
+		"kube_service_created",
+		"Unix creation timestamp of cluster services.",
+		[]string{
+			"kubernetes_namespace",
+			"kubernetes_name",
+		}, nil,
+	)
+	lbCostDesc = prometheus.NewDesc(
+		"kube_service_loadbalancer_hourly_cost",
+		"Estimated hourly cost in USD of LoadBalancer services.",
+		[]string{
+			"kubernetes_namespace",
+			"kubernetes_name",
+			"internal",
+		}, nil,
+	)
+	nsLbCount = prometheus.NewDesc(
+		"kube_svc_watch_namespace_loadbalancers",
+		"Number of LoadBalancer services in each namespace.",
+		[]string{"namespace", "internal"}, nil,
+	)
+	nsLbCost = prometheus.NewDesc(
+		"kube_svc_watch_namespace_loadbalancer_hourly_cost",
+		"Estimated hourly cost in USD of the LoadBalancer services in each namespace.",
+		[]string{"namespace", "internal"}, nil,
+	)
+	lbPending = prometheus.NewDesc(
+		"kube_service_loadbalancer_pending",
+		"LoadBalancer services that have been waiting too long for an address.",
+		[]string{
+			"kubernetes_namespace",
+			"kubernetes_name",
+		}, nil,
+	)
+	externalSvcs = prometheus.NewDesc(
+		"kube_svc_watch_external_services",
+		"Number of external services in each namespace.",
+		[]string{"namespace"}, nil,
+	)
+	exemptedSvcs = prometheus.NewDesc(
+		"kube_svc_watch_exempted_services",
+		"Number of external services exempted from enforcement.",
+		[]string{"namespace", "reason"}, nil,
+	)
+	duplicateLbs = prometheus.NewDesc(
+		"kube_svc_watch_duplicate_loadbalancers",
+		"Number of public LoadBalancer services in each namespace selecting the same pods, where there's more than one.",
+		[]string{"namespace", "selector"}, nil,
+	)
+	violationSeverity = prometheus.NewDesc(
+		"kube_svc_watch_violation_severity",
+		"Severity score of each unexempted public service.",
+		[]string{"namespace", "service"}, nil,
+	)
+)
+
+// Source is the cluster a ServiceCollector describes.  Its methods
+// are called on every scrape, so they should reflect the current
+// configuration.
+type Source interface {
+	// Services returns the Services in the cluster.
+	Services() []*v1.Service
+
+	// Policy returns the rules Services are judged by.
+	Policy() policy.Policy
+
+	// Severity scores svc, as policy.Policy.Severity does, with
+	// any weighting for its namespace.
+	Severity(svc *v1.Service) float64
+
+	// Pending reports whether svc has been waiting too long for
+	// its load balancer.
+	Pending(svc *v1.Service) bool
+
+	// HourlyCost returns the estimated hourly cost of svc's load
+	// balancer, and false if it doesn't have one or the price is
+	// unknown.
+	HourlyCost(svc *v1.Service) (float64, bool)
+
+	// NamespaceCosts summarises the load balancers in each
+	// namespace, or returns nil if costs aren't being estimated.
+	NamespaceCosts() map[string]NamespaceCost
+
+	// Duplicates returns the names of public LoadBalancer
+	// services that select the same pods as another.
+	Duplicates() map[Selector][]string
+}
+
+// NamespaceCost summarises the load balancers in a namespace.
+type NamespaceCost struct {
+	External           int
+	Internal           int
+	ExternalHourlyCost float64
+	InternalHourlyCost float64
+}
+
+// Selector identifies the pods a service selects.
+type Selector struct {
+	Namespace string
+	Selector  string
+}
+
+// ServiceOptions choose which Service labels and annotations a
+// ServiceCollector exports.
+type ServiceOptions struct {
+	// InfoLabels are Service labels copied onto
+	// kube_service_info.
+	InfoLabels []string
+
+	// Labels are Service labels exported as kube_service_labels.
+	// A single "*" exports every label found on any service.
+	Labels []string
+
+	// Annotations are Service annotations exported as
+	// kube_service_annotations.  Unlike labels, there's no "*":
+	// annotations are often long or unique, so they must be
+	// listed.
+	Annotations []string
+
+	// AnnotationMaxLen cuts annotation values to this many
+	// bytes, so a long value can't bloat every scrape.  0
+	// disables.
+	AnnotationMaxLen int
+}
+
+// ServiceCollector exports the Services in a Source in the style of
+// kube-state-metrics, along with kube-svc-watch's view of them.
+type ServiceCollector struct {
+	source Source
+	opts   ServiceOptions
+
+	svcInfo        *prometheus.Desc
+	annotations    []string
+	svcAnnotations *prometheus.Desc
+}
+
+// NewServiceCollector returns a collector for the Services in src.
+func NewServiceCollector(src Source, opts ServiceOptions) *ServiceCollector {
+	infoLabels := []string{
+		"kubernetes_namespace",
+		"kubernetes_name",
+		"type",
+		"internal",
+		"provider",
+		"reason",
+	}
+	for _, l := range opts.InfoLabels {
+		infoLabels = append(infoLabels, SanitizeLabelName(l))
+	}
+
+	// Distinct keys can sanitize to the same label name; the first
+	// one wins.
+	var used []string
+	annotationLabels := []string{"kubernetes_namespace", "kubernetes_name"}
+	seen := make(map[string]bool)
+	for _, k := range opts.Annotations {
+		name := SanitizeAnnotationName(k)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		annotationLabels = append(annotationLabels, name)
+		used = append(used, k)
+	}
+
+	return &ServiceCollector{
+		source:      src,
+		opts:        opts,
+		annotations: used,
+		svcInfo: prometheus.NewDesc(
+			"kube_service_info",
+			"Information about cluster services.",
+			infoLabels, nil,
+		),
+		svcAnnotations: prometheus.NewDesc(
+			"kube_service_annotations",
+			"Kubernetes annotations of cluster services, from -annotations-metric.",
+			annotationLabels, nil,
+		),
+	}
+}
+
+// SanitizeLabelName converts a Kubernetes label key into a
+// Prometheus label name, the same way kube-state-metrics does.
+func SanitizeLabelName(key string) string {
+	return "label_" + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+// SanitizeAnnotationName converts a Kubernetes annotation key into a
+// Prometheus label name, the same way kube-state-metrics does.
+func SanitizeAnnotationName(key string) string {
+	return "annotation_" + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// annotationValue returns the value of annotation key on svc, cut to
+// AnnotationMaxLen.
+func (c *ServiceCollector) annotationValue(svc *v1.Service, key string) string {
+	v := svc.Annotations[key]
+	if max := c.opts.AnnotationMaxLen; max > 0 && len(v) > max {
+		// Without a split rune, which would be invalid UTF-8.
+		v = strings.ToValidUTF8(v[:max], "")
+	}
+	return v
+}
+
+func (c *ServiceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.svcInfo
+	ch <- lbAddress
+	ch <- svcPorts
+	ch <- svcCreated
+	ch <- lbCostDesc
+	ch <- nsLbCount
+	ch <- nsLbCost
+	ch <- lbPending
+	ch <- externalSvcs
+	ch <- exemptedSvcs
+	ch <- violationSeverity
+	ch <- duplicateLbs
+	if len(c.annotations) > 0 {
+		ch <- c.svcAnnotations
+	}
+	// kube_service_labels is described at collection time, since
+	// its label names depend on the services present.
+}
+
+func (c *ServiceCollector) collectSvc(ch chan<- prometheus.Metric, p policy.Policy, svc *v1.Service) {
+	values := []string{
+		// Order must match c.svcInfo!
+		svc.Namespace,
+		svc.Name,
+		string(svc.Spec.Type),
+		fmt.Sprintf("%v", !p.IsExposed(svc)),
+		p.Provider,
+		p.ExternalReason(svc),
+	}
+	for _, l := range c.opts.InfoLabels {
+		values = append(values, svc.Labels[l])
+	}
+	ch <- prometheus.MustNewConstMetric(c.svcInfo,
+		prometheus.GaugeValue, 1, values...)
+
+	// Services with none of the annotations would only add series
+	// of empty labels.
+	if len(c.annotations) > 0 {
+		values := []string{svc.Namespace, svc.Name}
+		found := false
+		for _, k := range c.annotations {
+			v := c.annotationValue(svc, k)
+			found = found || v != ""
+			values = append(values, v)
+		}
+		if found {
+			ch <- prometheus.MustNewConstMetric(c.svcAnnotations,
+				prometheus.GaugeValue, 1, values...)
+		}
+	}
+
+	if !svc.CreationTimestamp.IsZero() {
+		ch <- prometheus.MustNewConstMetric(svcCreated,
+			prometheus.GaugeValue, float64(svc.CreationTimestamp.Unix()),
+			svc.Namespace, svc.Name)
+	}
+
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		ch <- prometheus.MustNewConstMetric(lbAddress,
+			prometheus.GaugeValue, 1,
+			// Order must match lbAddress!
+			svc.Namespace,
+			svc.Name,
+			ingress.IP,
+			ingress.Hostname,
+		)
+	}
+
+	if c.source.Pending(svc) {
+		ch <- prometheus.MustNewConstMetric(lbPending,
+			prometheus.GaugeValue, 1, svc.Namespace, svc.Name)
+	}
+
+	if cost, ok := c.source.HourlyCost(svc); ok {
+		ch <- prometheus.MustNewConstMetric(lbCostDesc,
+			prometheus.GaugeValue, cost,
+			// Order must match lbCostDesc!
+			svc.Namespace,
+			svc.Name,
+			fmt.Sprintf("%v", !p.IsExposed(svc)),
+		)
+	}
+
+	for _, port := range svc.Spec.Ports {
+		nodePort := ""
+		if port.NodePort != 0 {
+			nodePort = fmt.Sprintf("%d", port.NodePort)
+		}
+		ch <- prometheus.MustNewConstMetric(svcPorts,
+			prometheus.GaugeValue, 1,
+			// Order must match svcPorts!
+			svc.Namespace,
+			svc.Name,
+			port.Name,
+			fmt.Sprintf("%d", port.Port),
+			string(port.Protocol),
+			nodePort,
+		)
+	}
+}
+
+func (c *ServiceCollector) Collect(ch chan<- prometheus.Metric) {
+	p := c.source.Policy()
+	services := c.source.Services()
+
+	// Namespaces with services but no external ones are
+	// reported as 0, so absence isn't mistaken for compliance.
+	external := make(map[string]int)
+	exempted := make(map[[2]string]int)
+	for _, svc := range services {
+		c.collectSvc(ch, p, svc)
+		n := external[svc.Namespace]
+		if !p.IsInternal(svc) {
+			n++
+			if reason := p.ExemptReason(svc); reason != "" {
+				exempted[[2]string{svc.Namespace, reason}]++
+			} else {
+				ch <- prometheus.MustNewConstMetric(violationSeverity,
+					prometheus.GaugeValue, c.source.Severity(svc), svc.Namespace, svc.Name)
+			}
+		}
+		external[svc.Namespace] = n
+	}
+
+	for ns, n := range external {
+		ch <- prometheus.MustNewConstMetric(externalSvcs,
+			prometheus.GaugeValue, float64(n), ns)
+	}
+	for k, n := range exempted {
+		ch <- prometheus.MustNewConstMetric(exemptedSvcs,
+			prometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+
+	for key, names := range c.source.Duplicates() {
+		ch <- prometheus.MustNewConstMetric(duplicateLbs,
+			prometheus.GaugeValue, float64(len(names)), key.Namespace, key.Selector)
+	}
+
+	for ns, nc := range c.source.NamespaceCosts() {
+		ch <- prometheus.MustNewConstMetric(nsLbCount, prometheus.GaugeValue, float64(nc.External), ns, "false")
+		ch <- prometheus.MustNewConstMetric(nsLbCount, prometheus.GaugeValue, float64(nc.Internal), ns, "true")
+		ch <- prometheus.MustNewConstMetric(nsLbCost, prometheus.GaugeValue, nc.ExternalHourlyCost, ns, "false")
+		ch <- prometheus.MustNewConstMetric(nsLbCost, prometheus.GaugeValue, nc.InternalHourlyCost, ns, "true")
+	}
+
+	if len(c.opts.Labels) > 0 {
+		c.collectLabels(ch, services)
+	}
+}
+
+func (c *ServiceCollector) collectLabels(ch chan<- prometheus.Metric, services []*v1.Service) {
+	keys := c.opts.Labels
+	if len(keys) == 1 && keys[0] == "*" {
+		seen := make(map[string]bool)
+		keys = nil
+		for _, svc := range services {
+			for k := range svc.Labels {
+				if !seen[k] {
+					seen[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+		sort.Strings(keys)
+	}
+
+	// Distinct keys can sanitize to the same label name; the first
+	// one wins.
+	var names []string
+	var used []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		name := SanitizeLabelName(k)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		used = append(used, k)
+	}
+
+	desc := prometheus.NewDesc(
+		"kube_service_labels",
+		"Kubernetes labels of cluster services.",
+		append([]string{"kubernetes_namespace", "kubernetes_name"}, names...),
+		nil,
+	)
+	for _, svc := range services {
+		values := []string{svc.Namespace, svc.Name}
+		for _, k := range used {
+			values = append(values, svc.Labels[k])
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+	}
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	"github.com/anguslees/kube-svc-watch/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type fakeSource struct {
+	services []*v1.Service
+	costs    map[string]NamespaceCost
+	dups     map[Selector][]string
+}
+
+func (s fakeSource) Services() []*v1.Service { return s.services }
+
+func (s fakeSource) Policy() policy.Policy {
+	return policy.Policy{Provider: detect.ProviderAWS}
+}
+
+func (s fakeSource) Severity(svc *v1.Service) float64 {
+	return s.Policy().Severity(svc, 1)
+}
+
+func (s fakeSource) Pending(svc *v1.Service) bool {
+	return len(svc.Status.LoadBalancer.Ingress) == 0
+}
+
+func (s fakeSource) HourlyCost(svc *v1.Service) (float64, bool) {
+	return 0.025, svc.Spec.Type == v1.ServiceTypeLoadBalancer
+}
+
+func (s fakeSource) NamespaceCosts() map[string]NamespaceCost { return s.costs }
+
+func (s fakeSource) Duplicates() map[Selector][]string { return s.dups }
+
+func loadBalancer(namespace, name string, annotations, labels map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Annotations: annotations,
+			Labels:      labels,
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Port: 80, Protocol: v1.ProtocolTCP}},
+		},
+	}
+}
+
+// gather collects c, and returns its series as name{label="value",...}
+// mapped to their values.
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() failed: %v", err)
+	}
+	ret := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			var pairs []string
+			for _, l := range m.GetLabel() {
+				pairs = append(pairs, l.GetName()+"="+l.GetValue())
+			}
+			ret[mf.GetName()+"{"+strings.Join(pairs, ",")+"}"] = value(m)
+		}
+	}
+	return ret
+}
+
+func value(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.GetGauge().GetValue()
+	case m.Counter != nil:
+		return m.GetCounter().GetValue()
+	}
+	return 0
+}
+
+func TestServiceCollector(t *testing.T) {
+	internal := loadBalancer("ns1", "internal", map[string]string{detect.AWSLbInternal: detect.AWSLbInternalValue}, nil)
+	internal.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "internal.example.com"}}
+	public := loadBalancer("ns1", "public", nil, map[string]string{"team": "a"})
+	exempt := loadBalancer("ns2", "exempt", map[string]string{detect.ExemptAnnotation: "approved", "owner": strings.Repeat("x", 10)}, nil)
+
+	src := fakeSource{
+		services: []*v1.Service{internal, public, exempt},
+		costs:    map[string]NamespaceCost{"ns1": {External: 1, Internal: 1, ExternalHourlyCost: 0.025, InternalHourlyCost: 0.025}},
+		dups:     map[Selector][]string{{"ns1", "app=web"}: {"a", "b"}},
+	}
+	got := gather(t, NewServiceCollector(src, ServiceOptions{
+		InfoLabels:       []string{"team"},
+		Labels:           []string{"team"},
+		Annotations:      []string{"owner"},
+		AnnotationMaxLen: 4,
+	}))
+
+	want := map[string]float64{
+		`kube_service_info{internal=true,kubernetes_name=internal,kubernetes_namespace=ns1,label_team=,provider=aws,reason=,type=LoadBalancer}`:                            1,
+		`kube_service_info{internal=false,kubernetes_name=public,kubernetes_namespace=ns1,label_team=a,provider=aws,reason=missing-internal-annotation,type=LoadBalancer}`: 1,
+		`kube_service_loadbalancer_address{hostname=internal.example.com,ip=,kubernetes_name=internal,kubernetes_namespace=ns1}`:                                           1,
+		`kube_service_loadbalancer_pending{kubernetes_name=public,kubernetes_namespace=ns1}`:                                                                               1,
+		`kube_service_loadbalancer_hourly_cost{internal=false,kubernetes_name=public,kubernetes_namespace=ns1}`:                                                            0.025,
+		`kube_service_ports{kubernetes_name=public,kubernetes_namespace=ns1,node_port=,port=80,port_name=http,protocol=TCP}`:                                               1,
+		`kube_service_annotations{annotation_owner=xxxx,kubernetes_name=exempt,kubernetes_namespace=ns2}`:                                                                  1,
+		`kube_service_labels{kubernetes_name=public,kubernetes_namespace=ns1,label_team=a}`:                                                                                1,
+		`kube_svc_watch_external_services{namespace=ns1}`:                                                                                                                  1,
+		`kube_svc_watch_external_services{namespace=ns2}`:                                                                                                                  1,
+		`kube_svc_watch_exempted_services{namespace=ns2,reason=approved}`:                                                                                                  1,
+		`kube_svc_watch_duplicate_loadbalancers{namespace=ns1,selector=app=web}`:                                                                                           2,
+		`kube_svc_watch_namespace_loadbalancers{internal=false,namespace=ns1}`:                                                                                             1,
+		`kube_svc_watch_namespace_loadbalancer_hourly_cost{internal=true,namespace=ns1}`:                                                                                   0.025,
+		`kube_svc_watch_violation_severity{namespace=ns1,service=public}`:                                                                                                  src.Severity(public),
+	}
+	for k, v := range want {
+		if g, ok := got[k]; !ok {
+			t.Errorf("missing %s", k)
+		} else if g != v {
+			t.Errorf("%s = %v, want %v", k, g, v)
+		}
+	}
+	if _, ok := got[`kube_service_annotations{annotation_owner=,kubernetes_name=public,kubernetes_namespace=ns1}`]; ok {
+		t.Errorf("kube_service_annotations exported for a service without the annotations")
+	}
+	if _, ok := got[`kube_svc_watch_violation_severity{namespace=ns2,service=exempt}`]; ok {
+		t.Errorf("kube_svc_watch_violation_severity exported for an exempt service")
+	}
+}
+
+func TestServiceCollectorAllLabels(t *testing.T) {
+	src := fakeSource{services: []*v1.Service{
+		loadBalancer("ns", "a", nil, map[string]string{"app.kubernetes.io/name": "a"}),
+		loadBalancer("ns", "b", nil, map[string]string{"tier": "web"}),
+	}}
+	got := gather(t, NewServiceCollector(src, ServiceOptions{Labels: []string{"*"}}))
+
+	for _, k := range []string{
+		`kube_service_labels{kubernetes_name=a,kubernetes_namespace=ns,label_app_kubernetes_io_name=a,label_tier=}`,
+		`kube_service_labels{kubernetes_name=b,kubernetes_namespace=ns,label_app_kubernetes_io_name=,label_tier=web}`,
+	} {
+		if _, ok := got[k]; !ok {
+			t.Errorf("missing %s", k)
+		}
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, "svc")
+	if got := ErrorReason(notFound); got != string(metav1.StatusReasonNotFound) {
+		t.Errorf("ErrorReason(NotFound) = %q", got)
+	}
+	if got := ErrorReason(errors.New("boom")); got != "Unknown" {
+		t.Errorf("ErrorReason(non-API error) = %q, want Unknown", got)
+	}
+}
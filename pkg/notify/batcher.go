@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+)
+
+// Logger receives the batcher's retries and failures, as a message
+// and key-value pairs.
+type Logger interface {
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// BatchOptions control how a Batcher groups and retries events.
+type BatchOptions struct {
+	// Size is the most events sent at once.
+	Size int
+
+	// Interval is the longest an event is held before sending.
+	Interval time.Duration
+
+	// Retries is the number of times a failed batch is retried,
+	// with exponential backoff, before it is dropped.
+	Retries int
+
+	Logger Logger
+}
+
+// Batcher queues events and periodically hands them to send in
+// batches, retrying failed batches with exponential backoff.
+type Batcher struct {
+	backend string
+	send    func([]*Event) error
+	opts    BatchOptions
+	queue   chan *Event
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBatcher returns a running Batcher that sends events to backend
+// with send.  Close it to deliver whatever is still queued.
+func NewBatcher(backend string, send func([]*Event) error, opts BatchOptions) *Batcher {
+	b := &Batcher{
+		backend: backend,
+		send:    send,
+		opts:    opts,
+		queue:   make(chan *Event, 10*opts.Size),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *Batcher) Name() string {
+	return b.backend
+}
+
+func (b *Batcher) Notify(ev *Event) error {
+	select {
+	case b.queue <- ev:
+		return nil
+	default:
+		metrics.CountDropped(b.backend)
+		return fmt.Errorf("queue full, dropping event")
+	}
+}
+
+// Close flushes anything queued, and stops the batcher.
+func (b *Batcher) Close() {
+	close(b.stop)
+	<-b.done
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, b.opts.Size)
+	for {
+		select {
+		case ev := <-b.queue:
+			batch = append(batch, ev)
+			if len(batch) < b.opts.Size {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-b.stop:
+			b.drain(batch)
+			return
+		}
+		b.flush(batch)
+		batch = make([]*Event, 0, b.opts.Size)
+	}
+}
+
+func (b *Batcher) drain(batch []*Event) {
+	for {
+		select {
+		case ev := <-b.queue:
+			batch = append(batch, ev)
+			if len(batch) < b.opts.Size {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				b.flush(batch)
+			}
+			return
+		}
+		b.flush(batch)
+		batch = make([]*Event, 0, b.opts.Size)
+	}
+}
+
+func (b *Batcher) flush(batch []*Event) {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		err := b.send(batch)
+		if err == nil {
+			metrics.CountNotifications(b.backend, len(batch), nil)
+			return
+		}
+		if attempt >= b.opts.Retries {
+			b.opts.Logger.Error("Error sending events, giving up", "backend", b.backend, "events", len(batch), "error", err)
+			metrics.CountNotifications(b.backend, len(batch), err)
+			return
+		}
+		b.opts.Logger.Warn("Error sending events, retrying", "backend", b.backend, "events", len(batch), "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
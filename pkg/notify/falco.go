@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+)
+
+// Falco priorities of each action.
+var falcoPriorities = map[string]string{
+	ActionDetected:            "Warning",
+	ActionDeleted:             "Notice",
+	ActionDeleteFailed:        "Error",
+	ActionLbPending:           "Informational",
+	ActionIdleDeleted:         "Notice",
+	ActionEnforcementDisabled: "Critical",
+}
+
+// Falco writes events as single-line JSON in the format of Falco's
+// json_output, so pipelines that collect Falco's alerts (eg
+// Falcosidekick, or log shippers with a Falco parser) pick them up
+// from our container logs.
+type Falco struct {
+	mu   sync.Mutex
+	w    io.Writer
+	tags func(reason string) []string
+}
+
+// NewFalco returns a notifier that writes to w.  tags, if set,
+// returns extra tags for events with a reason, such as the
+// compliance controls it breaks.
+func NewFalco(w io.Writer, tags func(reason string) []string) *Falco {
+	return &Falco{w: w, tags: tags}
+}
+
+func (n *Falco) Name() string {
+	return "falco"
+}
+
+func (n *Falco) Notify(ev *Event) error {
+	priority, ok := falcoPriorities[ev.Action]
+	if !ok {
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"k8s.cluster.name": ev.Cluster,
+		"k8s.ns.name":      ev.Namespace,
+		"k8s.svc.name":     ev.Name,
+		"k8s.svc.uid":      ev.UID,
+		"k8s.svc.type":     ev.Type,
+		"ksw.action":       ev.Action,
+	}
+	output := fmt.Sprintf("Public Kubernetes service %s (cluster=%s namespace=%s service=%s type=%s", ev.Action, ev.Cluster, ev.Namespace, ev.Name, ev.Type)
+	if ev.Reason != "" {
+		fields["ksw.reason"] = ev.Reason
+		output += " reason=" + ev.Reason
+	}
+	if ev.Error != "" {
+		fields["ksw.error"] = ev.Error
+		output += " error=" + ev.Error
+	}
+	if ev.Owner != "" {
+		fields["ksw.owner"] = ev.Owner
+		output += " owner=" + ev.Owner
+	}
+	if ev.ChangedBy != "" {
+		fields["ka.user.name"] = ev.ChangedBy
+		output += " user=" + ev.ChangedBy
+	}
+	output += ")"
+
+	tags := []string{"k8s", "network", "kube-svc-watch"}
+	if ev.Reason != "" && n.tags != nil {
+		tags = append(tags, n.tags(ev.Reason)...)
+	}
+
+	line, err := json.Marshal(map[string]interface{}{
+		"time":          ev.Time,
+		"hostname":      ev.Cluster,
+		"source":        "kube-svc-watch",
+		"rule":          "Public Kubernetes service " + ev.Action,
+		"priority":      priority,
+		"output":        output,
+		"output_fields": fields,
+		"tags":          tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.w.Write(append(line, '\n'))
+	metrics.CountNotifications(n.Name(), 1, err)
+	return err
+}
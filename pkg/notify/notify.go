@@ -0,0 +1,122 @@
+// Package notify describes violations and enforcement actions as
+// Events, and delivers them to Notifiers: log pipelines such as
+// Splunk, Elasticsearch and Falco here, and whatever else a
+// controller implements the interface for.
+package notify
+
+import (
+	"time"
+)
+
+// Actions an Event can describe.
+const (
+	ActionDetected     = "detected"
+	ActionDeleted      = "deleted"
+	ActionDeleteFailed = "delete-failed"
+	ActionLbPending    = "loadbalancer-pending"
+	ActionIdleDeleted  = "idle-deleted"
+
+	// ActionEnforcementDisabled is for operators, rather than
+	// service owners.
+	ActionEnforcementDisabled = "enforcement-disabled"
+)
+
+// Event is a single violation or enforcement action, as handed to
+// Notifiers.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Cluster   string    `json:"cluster"`
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       string    `json:"uid"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+
+	// Owner and OwnerSlackChannel come from the Namespace
+	// metadata, if configured.
+	Owner             string `json:"owner,omitempty"`
+	OwnerSlackChannel string `json:"ownerSlackChannel,omitempty"`
+
+	// CreatorEmail and OwnerEmail come from the Service or
+	// Namespace annotations, if configured.
+	CreatorEmail string   `json:"creatorEmail,omitempty"`
+	OwnerEmail   []string `json:"ownerEmail,omitempty"`
+
+	// FieldManager last set the fields that made the service
+	// public, according to its managedFields.  ChangedBy is the
+	// user who last changed it, if known from audit events.
+	FieldManager string `json:"fieldManager,omitempty"`
+	ChangedBy    string `json:"changedBy,omitempty"`
+
+	// Changes are what an update changed to make the service
+	// public, if it wasn't before.
+	Changes []string `json:"changes,omitempty"`
+
+	// Termination is when a detected service is due to be
+	// deleted: now, or its scheduled deadline.  It is nil if
+	// we're only notifying about it.
+	Termination *time.Time `json:"termination,omitempty"`
+
+	// Reachable is whether the service's load balancer accepted
+	// a connection when last probed, if it has been.
+	Reachable *bool `json:"reachable,omitempty"`
+
+	// PublicHostnames are the service's hostnames that resolved
+	// on public DNS servers, if they were checked.
+	PublicHostnames []string `json:"publicHostnames,omitempty"`
+
+	// Repeat is set on detections that have already been
+	// notified, which only Stateful notifiers see.
+	Repeat bool `json:"-"`
+}
+
+// Notifier delivers Events somewhere: a log pipeline, a chat
+// channel, or whatever else wants to know.
+type Notifier interface {
+	// Notify delivers (or queues for delivery) ev.  Notifiers
+	// are expected to ignore actions they aren't interested in.
+	Notify(ev *Event) error
+	Name() string
+}
+
+// Closer is implemented by notifiers that queue events, to deliver
+// them before we exit.
+type Closer interface {
+	Close()
+}
+
+// Stateful is implemented by notifiers that keep track of which
+// violations are current, rather than messaging people, such as
+// Alertmanager.  They see every detection, including repeats, so
+// they can rebuild their state after a restart.
+type Stateful interface {
+	Stateful()
+}
+
+// Adopter is implemented by notifiers that take over the state of
+// the ones they replace on a reload.
+type Adopter interface {
+	Adopt(old Notifiers)
+}
+
+// Wants reports whether n should be given ev: repeats only go to
+// Stateful notifiers.
+func Wants(n Notifier, ev *Event) bool {
+	_, ok := n.(Stateful)
+	return ok || !ev.Repeat
+}
+
+// Notifiers are the notifiers in use.
+type Notifiers []Notifier
+
+// Close closes each of ns that is a Closer, delivering everything
+// they were given.
+func (ns Notifiers) Close() {
+	for _, n := range ns {
+		if c, ok := n.(Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Warn(msg string, kv ...interface{})  {}
+func (testLogger) Error(msg string, kv ...interface{}) {}
+
+var testOpts = BatchOptions{Size: 2, Interval: time.Hour, Retries: 1, Logger: testLogger{}}
+
+func testEvent(name string) *Event {
+	return &Event{
+		Time:      time.Unix(1500000000, 0).UTC(),
+		Cluster:   "k8s",
+		Action:    ActionDetected,
+		Namespace: "default",
+		Name:      name,
+		Type:      "LoadBalancer",
+		Reason:    "missing-internal-annotation",
+	}
+}
+
+type stateful struct{ *Falco }
+
+func (stateful) Stateful() {}
+
+func TestWants(t *testing.T) {
+	ev := testEvent("svc")
+	ev.Repeat = true
+	if Wants(NewFalco(ioutil.Discard, nil), ev) {
+		t.Errorf("repeat given to a notifier that isn't Stateful")
+	}
+	if !Wants(stateful{NewFalco(ioutil.Discard, nil)}, ev) {
+		t.Errorf("repeat not given to a Stateful notifier")
+	}
+	ev.Repeat = false
+	if !Wants(NewFalco(ioutil.Discard, nil), ev) {
+		t.Errorf("new detection not given to a notifier")
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	b := NewBatcher("test", func(batch []*Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var names []string
+		for _, ev := range batch {
+			names = append(names, ev.Name)
+		}
+		batches = append(batches, names)
+		return nil
+	}, testOpts)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := b.Notify(testEvent(name)); err != nil {
+			t.Fatalf("Notify(%s) failed: %v", name, err)
+		}
+	}
+	// Close delivers the last, partial, batch.
+	b.Close()
+
+	want := [][]string{{"a", "b"}, {"c"}}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != len(want) {
+		t.Fatalf("sent %v, want %v", batches, want)
+	}
+	for i := range want {
+		if strings.Join(batches[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("batch %d = %v, want %v", i, batches[i], want[i])
+		}
+	}
+}
+
+func TestBatcherRetries(t *testing.T) {
+	attempts := 0
+	b := NewBatcher("test", func(batch []*Event) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}, testOpts)
+	b.Notify(testEvent("a"))
+	b.Close()
+
+	if attempts != 2 {
+		t.Errorf("sent %d times, want a failure and a retry", attempts)
+	}
+}
+
+func TestSplunkHEC(t *testing.T) {
+	var auth string
+	var lines []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" {
+			t.Errorf("posted to %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			var v map[string]interface{}
+			if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+				t.Errorf("invalid line %q: %v", s.Text(), err)
+			}
+			lines = append(lines, v)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewSplunkHEC(srv.Client(), srv.URL+"/", "secret", testOpts)
+	n.Notify(testEvent("a"))
+	n.Close()
+
+	if auth != "Splunk secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("got %d events, want 1", len(lines))
+	}
+	if got := lines[0]["time"]; got != 1500000000.0 {
+		t.Errorf("time = %v", got)
+	}
+	if ev, _ := lines[0]["event"].(map[string]interface{}); ev["name"] != "a" {
+		t.Errorf("event = %v", lines[0]["event"])
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	var lines []string
+	requests := 0
+	bulkErrors := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("posted %s to %s", r.Header.Get("Content-Type"), r.URL.Path)
+		}
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		lines = strings.Split(strings.TrimSpace(string(body)), "\n")
+		json.NewEncoder(w).Encode(map[string]bool{"errors": bulkErrors})
+	}))
+	defer srv.Close()
+
+	send := func(ev *Event) {
+		n := NewElasticsearch(srv.Client(), srv.URL, "events", testOpts)
+		n.Notify(ev)
+		n.Close()
+	}
+	send(testEvent("a"))
+	if len(lines) != 2 || lines[0] != `{"index":{"_index":"events"}}` || !strings.Contains(lines[1], `"name":"a"`) {
+		t.Errorf("bulk request = %q", lines)
+	}
+
+	// Per-document failures come back with a 200, and are
+	// reported as errors, so they're retried.
+	bulkErrors = true
+	requests = 0
+	send(testEvent("b"))
+	if requests != 1+testOpts.Retries {
+		t.Errorf("bulk request with errors sent %d times, want %d", requests, 1+testOpts.Retries)
+	}
+}
+
+func TestFalco(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewFalco(&buf, func(reason string) []string { return []string{"CIS-5.4"} })
+
+	ev := testEvent("a")
+	ev.ChangedBy = "alice"
+	if err := n.Notify(ev); err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+	if err := n.Notify(&Event{Action: "unknown"}); err != nil || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("unknown action was written, or failed: %v", err)
+	}
+
+	var got struct {
+		Rule         string            `json:"rule"`
+		Priority     string            `json:"priority"`
+		Output       string            `json:"output"`
+		OutputFields map[string]string `json:"output_fields"`
+		Tags         []string          `json:"tags"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid output %q: %v", buf.String(), err)
+	}
+	if got.Rule != "Public Kubernetes service detected" || got.Priority != "Warning" {
+		t.Errorf("rule %q, priority %q", got.Rule, got.Priority)
+	}
+	if want := "Public Kubernetes service detected (cluster=k8s namespace=default service=a type=LoadBalancer reason=missing-internal-annotation user=alice)"; got.Output != want {
+		t.Errorf("output = %q, want %q", got.Output, want)
+	}
+	if got.OutputFields["ka.user.name"] != "alice" || got.OutputFields["ksw.reason"] != ev.Reason {
+		t.Errorf("output_fields = %v", got.OutputFields)
+	}
+	if tags := strings.Join(got.Tags, ","); tags != "k8s,network,kube-svc-watch,CIS-5.4" {
+		t.Errorf("tags = %s", tags)
+	}
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Post sends body to url with client, and returns the response body,
+// or an error unless the status is 2xx.  setHeaders, if set, can add
+// to the request.
+func Post(client *http.Client, url, contentType string, body io.Reader, setHeaders func(*http.Request)) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if setHeaders != nil {
+		setHeaders(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// NewSplunkHEC returns a notifier that sends events to a Splunk HTTP
+// Event Collector.
+func NewSplunkHEC(client *http.Client, baseURL, token string, opts BatchOptions) *Batcher {
+	url := strings.TrimSuffix(baseURL, "/") + "/services/collector/event"
+	return NewBatcher("splunk", func(batch []*Event) error {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, ev := range batch {
+			err := enc.Encode(map[string]interface{}{
+				"time":       float64(ev.Time.UnixNano()) / 1e9,
+				"source":     "kube-svc-watch",
+				"sourcetype": "_json",
+				"event":      ev,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		_, err := Post(client, url, "application/json", &buf, func(req *http.Request) {
+			req.Header.Set("Authorization", "Splunk "+token)
+		})
+		return err
+	}, opts)
+}
+
+// NewElasticsearch returns a notifier that indexes events into an
+// Elasticsearch index using the bulk API.  Credentials may be
+// embedded in the URL.
+func NewElasticsearch(client *http.Client, baseURL, index string, opts BatchOptions) *Batcher {
+	url := strings.TrimSuffix(baseURL, "/") + "/_bulk"
+	return NewBatcher("elasticsearch", func(batch []*Event) error {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, ev := range batch {
+			meta := map[string]interface{}{
+				"index": map[string]string{"_index": index},
+			}
+			if err := enc.Encode(meta); err != nil {
+				return err
+			}
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+		}
+		body, err := Post(client, url, "application/x-ndjson", &buf, nil)
+		if err != nil {
+			return err
+		}
+
+		// The bulk API reports per-document failures with a 200.
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return err
+		}
+		if result.Errors {
+			return fmt.Errorf("bulk request had errors: %s", body)
+		}
+		return nil
+	}, opts)
+}
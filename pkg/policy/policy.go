@@ -0,0 +1,103 @@
+// Package policy decides which Services are violations, and how bad
+// they are, on top of the classification in pkg/detect.  Unlike
+// detect, it takes account of exemptions, snoozes and default-deny,
+// as configured in a Policy.
+package policy
+
+import (
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	"k8s.io/api/core/v1"
+)
+
+// Policy is a set of rules for Services.  The zero value, apart from
+// Provider, applies detect's rules as they are.
+type Policy struct {
+	// Provider is the cloud provider, detect.ProviderAWS or
+	// detect.ProviderGCP.
+	Provider string
+
+	// DefaultDeny treats internal LoadBalancer services as
+	// public too, so every load balancer needs an exemption.
+	DefaultDeny bool
+
+	// Snoozed, if set, returns why svc is temporarily allowed to
+	// be public, or "" if it isn't.
+	Snoozed func(svc *v1.Service) string
+}
+
+// ExternalReason returns why svc is considered public, or "" if it
+// is internal.
+func (p Policy) ExternalReason(svc *v1.Service) string {
+	reason := detect.ExternalReason(p.Provider, svc)
+	if reason == "" && p.DefaultDeny && svc.Spec.Type == v1.ServiceTypeLoadBalancer {
+		return detect.ReasonNotApproved
+	}
+	return reason
+}
+
+// IsInternal reports whether svc isn't considered public.
+func (p Policy) IsInternal(svc *v1.Service) bool {
+	return p.ExternalReason(svc) == ""
+}
+
+// IsExposed reports whether svc has a load balancer reachable from
+// outside the cluster's network, whatever DefaultDeny says.
+func (p Policy) IsExposed(svc *v1.Service) bool {
+	return !detect.IsInternal(p.Provider, svc)
+}
+
+// ExemptReason returns why svc is allowed to be public, or "" if it
+// isn't exempt.
+func (p Policy) ExemptReason(svc *v1.Service) string {
+	if reason := detect.ExemptReason(svc); reason != "" {
+		return reason
+	}
+	if p.Snoozed != nil {
+		return p.Snoozed(svc)
+	}
+	return ""
+}
+
+// IsViolation reports whether svc is public without an exemption.
+func (p Policy) IsViolation(svc *v1.Service) bool {
+	return !p.IsInternal(svc) && p.ExemptReason(svc) == ""
+}
+
+// SensitivePorts are particularly bad news on the internet.
+var SensitivePorts = map[int32]bool{
+	22:    true, // ssh
+	2379:  true, // etcd
+	3306:  true, // mysql
+	3389:  true, // rdp
+	5432:  true, // postgres
+	6379:  true, // redis
+	9200:  true, // elasticsearch
+	10250: true, // kubelet
+	27017: true, // mongodb
+}
+
+// Severity scores how bad a violation is, or returns 0 if svc isn't
+// one.  Open source ranges score 5, restricted ones 2 and unapproved
+// internal ones (with DefaultDeny) 1, plus 1 for each exposed port
+// and another 2 for SensitivePorts.  The total is multiplied by
+// weight, eg for how critical the namespace is.
+func (p Policy) Severity(svc *v1.Service, weight float64) float64 {
+	if !p.IsViolation(svc) {
+		return 0
+	}
+
+	score := 5.0
+	switch p.ExternalReason(svc) {
+	case detect.ReasonRestrictedSourceRanges:
+		score = 2
+	case detect.ReasonNotApproved:
+		score = 1
+	}
+	for _, port := range svc.Spec.Ports {
+		score++
+		if SensitivePorts[port.Port] {
+			score += 2
+		}
+	}
+	return score * weight
+}
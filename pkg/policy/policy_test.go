@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func loadBalancer(annotations map[string]string, ranges []string, ports ...int32) *v1.Service {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "svc",
+			Annotations: make(map[string]string),
+		},
+		Spec: v1.ServiceSpec{
+			Type:                     v1.ServiceTypeLoadBalancer,
+			LoadBalancerSourceRanges: ranges,
+		},
+	}
+	for k, v := range annotations {
+		svc.Annotations[k] = v
+	}
+	for _, p := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Port: p, Protocol: v1.ProtocolTCP})
+	}
+	return svc
+}
+
+var internalAWS = map[string]string{detect.AWSLbInternal: detect.AWSLbInternalValue}
+
+func TestDefaultDeny(t *testing.T) {
+	svc := loadBalancer(internalAWS, nil)
+
+	p := Policy{Provider: detect.ProviderAWS}
+	if got := p.ExternalReason(svc); got != "" {
+		t.Errorf("ExternalReason() = %q, want internal", got)
+	}
+
+	p.DefaultDeny = true
+	if got := p.ExternalReason(svc); got != detect.ReasonNotApproved {
+		t.Errorf("ExternalReason() with DefaultDeny = %q, want %q", got, detect.ReasonNotApproved)
+	}
+	if !p.IsViolation(svc) {
+		t.Errorf("unapproved internal service isn't a violation with DefaultDeny")
+	}
+	if p.IsExposed(svc) {
+		t.Errorf("internal service is exposed with DefaultDeny")
+	}
+
+	svc.Annotations[detect.ExemptAnnotation] = "approved"
+	if p.IsViolation(svc) {
+		t.Errorf("exempt internal service is a violation with DefaultDeny")
+	}
+
+	clusterIP := loadBalancer(nil, nil)
+	clusterIP.Spec.Type = v1.ServiceTypeClusterIP
+	if got := p.ExternalReason(clusterIP); got != "" {
+		t.Errorf("ExternalReason() of a ClusterIP service with DefaultDeny = %q, want internal", got)
+	}
+}
+
+func TestSnoozed(t *testing.T) {
+	svc := loadBalancer(nil, nil)
+	p := Policy{
+		Provider: detect.ProviderAWS,
+		Snoozed: func(s *v1.Service) string {
+			if s.Name == "svc" {
+				return "snoozed"
+			}
+			return ""
+		},
+	}
+	if got := p.ExemptReason(svc); got != "snoozed" {
+		t.Errorf("ExemptReason() = %q, want %q", got, "snoozed")
+	}
+	if p.IsViolation(svc) {
+		t.Errorf("snoozed service is a violation")
+	}
+	if !p.IsExposed(svc) {
+		t.Errorf("snoozed public service isn't exposed")
+	}
+
+	// The annotation's explanation wins.
+	svc.Annotations = map[string]string{detect.ExemptAnnotation: "public website"}
+	if got := p.ExemptReason(svc); got != "public website" {
+		t.Errorf("ExemptReason() = %q, want %q", got, "public website")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		name        string
+		svc         *v1.Service
+		defaultDeny bool
+		weight      float64
+		want        float64
+	}{
+		{
+			name:   "internal",
+			svc:    loadBalancer(internalAWS, nil, 80),
+			weight: 1,
+			want:   0,
+		},
+		{
+			name:   "exempt",
+			svc:    loadBalancer(map[string]string{detect.ExemptAnnotation: "ok"}, nil, 80),
+			weight: 1,
+			want:   0,
+		},
+		{
+			name:   "open",
+			svc:    loadBalancer(nil, nil, 80, 443),
+			weight: 1,
+			want:   7,
+		},
+		{
+			name:   "sensitive port",
+			svc:    loadBalancer(nil, nil, 22),
+			weight: 1,
+			want:   8,
+		},
+		{
+			name:   "restricted source ranges",
+			svc:    loadBalancer(nil, []string{"10.0.0.0/8"}, 80),
+			weight: 1,
+			want:   3,
+		},
+		{
+			name:        "not approved",
+			svc:         loadBalancer(internalAWS, nil, 80),
+			defaultDeny: true,
+			weight:      1,
+			want:        2,
+		},
+		{
+			name:   "weighted",
+			svc:    loadBalancer(nil, nil, 80),
+			weight: 2.5,
+			want:   15,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Policy{Provider: detect.ProviderAWS, DefaultDeny: test.defaultDeny}
+			if got := p.Severity(test.svc, test.weight); got != test.want {
+				t.Errorf("Severity() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package terminate deletes public Services without racing their
+// owners: a Service that is fixed while it's being deleted is left
+// alone.
+package terminate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/policy"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PendingAnnotation marks a service we're about to delete.  Its value
+// is when it was marked, in RFC 3339 format.
+const PendingAnnotation = "kube-svc-watch/pending-termination"
+
+// Logger receives failures that don't stop a delete, as a message and
+// key-value pairs.
+type Logger interface {
+	Warn(msg string, kv ...interface{})
+}
+
+// Deleter deletes Services that are still violations when it gets to
+// them.
+type Deleter struct {
+	// Reader re-reads services, rather than trusting a cache
+	// that may be behind.
+	Reader kubernetes.Interface
+
+	// Writer marks and deletes services.  It may impersonate a
+	// user allowed to do so, and is otherwise Reader.
+	Writer kubernetes.Interface
+
+	// FieldManager is recorded on our updates, so they can be
+	// told apart from the owner's.
+	FieldManager string
+
+	// Policy returns the rules services are judged by.  It is
+	// called on every Delete, so it can follow configuration
+	// changes.
+	Policy func() policy.Policy
+
+	Logger Logger
+}
+
+// Delete deletes svc in two phases, so that a service its owner has
+// fixed is never deleted: it is first annotated as pending
+// termination, then re-read to check that it's still the public
+// version we annotated, and only then deleted, with that version as a
+// precondition.  It returns the deleted service, or nil if svc was
+// fixed or is already gone.
+func (d *Deleter) Delete(ctx context.Context, svc *v1.Service) (*v1.Service, error) {
+	services := d.Writer.CoreV1().Services(svc.Namespace)
+	get := func() (*v1.Service, error) {
+		return d.Reader.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+	}
+	p := d.Policy()
+	stillPublic := func(live *v1.Service) bool {
+		return live.UID == svc.UID && p.IsViolation(live)
+	}
+
+	// Our cache may be behind.
+	live, err := get()
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !stillPublic(live) {
+		d.Unmark(ctx, live)
+		return nil, nil
+	}
+
+	// Update, rather than patch, so this fails with a conflict
+	// if the service has changed since we checked it.
+	marked := live.DeepCopy()
+	if marked.Annotations == nil {
+		marked.Annotations = make(map[string]string)
+	}
+	marked.Annotations[PendingAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	marked, err = services.Update(ctx, marked, metav1.UpdateOptions{FieldManager: d.FieldManager})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	live, err = get()
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !stillPublic(live) {
+		d.Unmark(ctx, live)
+		return nil, nil
+	}
+	if live.ResourceVersion != marked.ResourceVersion {
+		return nil, fmt.Errorf("service changed while pending termination")
+	}
+
+	err = services.Delete(ctx, svc.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &live.UID,
+			ResourceVersion: &live.ResourceVersion,
+		},
+	})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// Unmark removes PendingAnnotation from a service that was fixed
+// before we could delete it.
+func (d *Deleter) Unmark(ctx context.Context, svc *v1.Service) {
+	if _, ok := svc.Annotations[PendingAnnotation]; !ok {
+		return
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, PendingAnnotation)
+	_, err := d.Writer.CoreV1().Services(svc.Namespace).Patch(ctx, svc.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: d.FieldManager})
+	if err != nil && !errors.IsNotFound(err) {
+		d.Logger.Warn("Error removing annotation", "namespace", svc.Namespace, "service", svc.Name, "annotation", PendingAnnotation, "error", err)
+	}
+}
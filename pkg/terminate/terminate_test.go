@@ -0,0 +1,204 @@
+package terminate
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+	"github.com/anguslees/kube-svc-watch/pkg/policy"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const svcPath = "/api/v1/namespaces/default/services/svc"
+
+// fakeAPI serves a single Service, and records the requests made for
+// it.
+type fakeAPI struct {
+	mu       sync.Mutex
+	svc      *v1.Service
+	requests []string
+	patches  []string
+
+	// afterUpdate, if set, changes the service after we mark it,
+	// as its owner might.
+	afterUpdate func(svc *v1.Service)
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != svcPath {
+		http.NotFound(w, r)
+		return
+	}
+	f.requests = append(f.requests, r.Method)
+	if f.svc == nil {
+		writeJSON(w, http.StatusNotFound, metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Code:     http.StatusNotFound,
+		})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var svc v1.Service
+		if err := json.NewDecoder(r.Body).Decode(&svc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if svc.ResourceVersion != f.svc.ResourceVersion {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.svc = &svc
+		f.bump()
+		marked := f.svc.DeepCopy()
+		if f.afterUpdate != nil {
+			f.afterUpdate(f.svc)
+			f.bump()
+		}
+		writeJSON(w, http.StatusOK, marked)
+		return
+	case "PATCH":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.patches = append(f.patches, string(body))
+		delete(f.svc.Annotations, PendingAnnotation)
+		f.bump()
+	case "DELETE":
+		var opts metav1.DeleteOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil || opts.Preconditions == nil ||
+			*opts.Preconditions.UID != f.svc.UID || *opts.Preconditions.ResourceVersion != f.svc.ResourceVersion {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		deleted := f.svc
+		f.svc = nil
+		writeJSON(w, http.StatusOK, deleted)
+		return
+	}
+	writeJSON(w, http.StatusOK, f.svc)
+}
+
+func (f *fakeAPI) bump() {
+	rv, _ := strconv.Atoi(f.svc.ResourceVersion)
+	f.svc.ResourceVersion = strconv.Itoa(rv + 1)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func publicService() *v1.Service {
+	return &v1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "svc",
+			UID:             "uid-1",
+			ResourceVersion: "1",
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+}
+
+type testLogger struct{}
+
+func (testLogger) Warn(msg string, kv ...interface{}) {}
+
+func newDeleter(t *testing.T, f *fakeAPI) *Deleter {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("NewForConfig() failed: %v", err)
+	}
+	return &Deleter{
+		Reader:       client,
+		Writer:       client,
+		FieldManager: "kube-svc-watch",
+		Policy:       func() policy.Policy { return policy.Policy{Provider: detect.ProviderAWS} },
+		Logger:       testLogger{},
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := &fakeAPI{svc: publicService()}
+	deleted, err := newDeleter(t, f).Delete(context.Background(), publicService())
+	if err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if deleted == nil || deleted.Annotations[PendingAnnotation] == "" {
+		t.Errorf("Delete() returned %v, want the marked service", deleted)
+	}
+	if want := "GET PUT GET DELETE"; strings.Join(f.requests, " ") != want {
+		t.Errorf("requests %s, want %s", strings.Join(f.requests, " "), want)
+	}
+}
+
+func TestDeleteFixed(t *testing.T) {
+	// Fixed while we were marking it.
+	f := &fakeAPI{svc: publicService(), afterUpdate: func(svc *v1.Service) {
+		svc.Annotations[detect.AWSLbInternal] = detect.AWSLbInternalValue
+	}}
+	deleted, err := newDeleter(t, f).Delete(context.Background(), publicService())
+	if err != nil || deleted != nil {
+		t.Errorf("Delete() = %v, %v, want nothing deleted", deleted, err)
+	}
+	if want := "GET PUT GET PATCH"; strings.Join(f.requests, " ") != want {
+		t.Errorf("requests %s, want %s", strings.Join(f.requests, " "), want)
+	}
+	if len(f.patches) != 1 || !strings.Contains(f.patches[0], `"`+PendingAnnotation+`":null`) {
+		t.Errorf("fixed service unmarked with %q", f.patches)
+	}
+}
+
+func TestDeleteChanged(t *testing.T) {
+	// Changed while we were marking it, but still public.
+	f := &fakeAPI{svc: publicService(), afterUpdate: func(svc *v1.Service) {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Port: 22})
+	}}
+	if _, err := newDeleter(t, f).Delete(context.Background(), publicService()); err == nil {
+		t.Errorf("Delete() of a changed service succeeded")
+	}
+	if f.svc == nil {
+		t.Errorf("changed service was deleted")
+	}
+}
+
+func TestDeleteGone(t *testing.T) {
+	f := &fakeAPI{}
+	deleted, err := newDeleter(t, f).Delete(context.Background(), publicService())
+	if err != nil || deleted != nil {
+		t.Errorf("Delete() of a missing service = %v, %v", deleted, err)
+	}
+}
+
+func TestDeleteRecreated(t *testing.T) {
+	// Deleted and recreated under the same name since we saw it.
+	svc := publicService()
+	svc.UID = "uid-2"
+	f := &fakeAPI{svc: svc}
+	deleted, err := newDeleter(t, f).Delete(context.Background(), publicService())
+	if err != nil || deleted != nil {
+		t.Errorf("Delete() of a recreated service = %v, %v", deleted, err)
+	}
+	if want := "GET"; strings.Join(f.requests, " ") != want {
+		t.Errorf("requests %s, want %s", strings.Join(f.requests, " "), want)
+	}
+}
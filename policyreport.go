@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// PolicyReports are defined by the Kubernetes Policy working group's
+// CRDs, which are installed with Kyverno or Policy Reporter.
+var policyReportResource = schema.GroupVersionResource{
+	Group:    "wgpolicyk8s.io",
+	Version:  "v1alpha2",
+	Resource: "policyreports",
+}
+
+const (
+	// Name of our PolicyReport in each namespace.
+	policyReportName = "kube-svc-watch"
+	// Label marking the PolicyReports we manage.
+	policyReportSelector = "app.kubernetes.io/managed-by=kube-svc-watch"
+
+	policyReportPolicy   = "kube-svc-watch-public-services"
+	policyReportCategory = "Network Exposure"
+)
+
+type policyReportResult struct {
+	Source     string                `json:"source"`
+	Policy     string                `json:"policy"`
+	Rule       string                `json:"rule"`
+	Category   string                `json:"category"`
+	Result     string                `json:"result"`
+	Severity   string                `json:"severity,omitempty"`
+	Scored     bool                  `json:"scored"`
+	Message    string                `json:"message"`
+	Resources  []v1.ObjectReference  `json:"resources"`
+	Properties map[string]string     `json:"properties,omitempty"`
+	Timestamp  policyReportTimestamp `json:"timestamp"`
+}
+
+type policyReportTimestamp struct {
+	Seconds int64 `json:"seconds"`
+	Nanos   int32 `json:"nanos"`
+}
+
+type policyReportSummary struct {
+	Pass  int `json:"pass"`
+	Fail  int `json:"fail"`
+	Warn  int `json:"warn"`
+	Error int `json:"error"`
+	Skip  int `json:"skip"`
+}
+
+// policyReporter keeps a PolicyReport up to date in each namespace
+// with LoadBalancer services, so our findings show up alongside other
+// policy engines' in Policy Reporter and the like.  Public services
+// fail, exempt ones are skipped and internal ones pass.
+type policyReporter struct {
+	client dynamic.Interface
+	// shard is this replica's shardFilter, or nil.
+	shard func(metav1.Object) bool
+}
+
+func newPolicyReporter(client dynamic.Interface, shard func(metav1.Object) bool) *policyReporter {
+	return &policyReporter{client: client, shard: shard}
+}
+
+// owns reports whether obj is in a namespace we watch, so its report
+// is ours to delete.
+func (r *policyReporter) owns(obj metav1.Object) bool {
+	if r.shard != nil && !r.shard(obj) {
+		return false
+	}
+	if len(namespaces) == 0 {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == obj.GetNamespace() {
+			return true
+		}
+	}
+	return false
+}
+
+// run updates c's reports every -policy-report-interval, until we
+// stop.
+func (r *policyReporter) run(c *cluster) {
+	ticker := time.NewTicker(*policyReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+		synced := true
+		for _, informer := range c.services {
+			synced = synced && informer.HasSynced()
+		}
+		if !synced {
+			continue
+		}
+		if err := r.sync(c); err != nil {
+			logError("Error updating PolicyReports", "cluster", c.name, "error", err)
+		}
+	}
+}
+
+func (r *policyReporter) sync(c *cluster) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+
+	existing := make(map[string]*unstructured.Unstructured)
+	list, err := r.client.Resource(policyReportResource).List(ctx, metav1.ListOptions{LabelSelector: policyReportSelector})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if obj.GetName() == policyReportName && r.owns(obj) {
+			existing[obj.GetNamespace()] = obj
+		}
+	}
+
+	results := make(map[string][]policyReportResult)
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		results[svc.Namespace] = append(results[svc.Namespace], c.policyReportResult(svc))
+	}
+
+	for ns, rs := range results {
+		if err := r.write(ctx, ns, existing[ns], rs); err != nil {
+			logError("Error writing PolicyReport", "namespace", ns, "error", err)
+		}
+	}
+	for ns, obj := range existing {
+		if _, ok := results[ns]; ok {
+			continue
+		}
+		err := r.client.Resource(policyReportResource).Namespace(ns).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			logError("Error deleting PolicyReport", "namespace", ns, "error", err)
+		}
+	}
+	return nil
+}
+
+// write creates or updates the report in namespace.  Unchanged
+// results keep their old timestamps, so an unchanged report isn't
+// rewritten.
+func (r *policyReporter) write(ctx context.Context, namespace string, old *unstructured.Unstructured, results []policyReportResult) error {
+	var oldResults []policyReportResult
+	if old != nil {
+		if raw, ok := old.Object["results"]; ok {
+			b, err := json.Marshal(raw)
+			if err == nil {
+				json.Unmarshal(b, &oldResults)
+			}
+		}
+	}
+	timestamps := make(map[string]policyReportTimestamp, len(oldResults))
+	for _, res := range oldResults {
+		timestamps[policyResultKey(res)] = res.Timestamp
+	}
+	var summary policyReportSummary
+	for i := range results {
+		if ts, ok := timestamps[policyResultKey(results[i])]; ok {
+			results[i].Timestamp = ts
+		}
+		switch results[i].Result {
+		case "pass":
+			summary.Pass++
+		case "fail":
+			summary.Fail++
+		case "skip":
+			summary.Skip++
+		}
+	}
+	sortPolicyResults(results)
+	if old != nil && reflect.DeepEqual(results, oldResults) {
+		return nil
+	}
+
+	content, err := toUnstructuredMap(map[string]interface{}{
+		"results": results,
+		"summary": summary,
+	})
+	if err != nil {
+		return err
+	}
+	client := r.client.Resource(policyReportResource).Namespace(namespace)
+	if old == nil {
+		obj := &unstructured.Unstructured{Object: content}
+		obj.SetAPIVersion(policyReportResource.GroupVersion().String())
+		obj.SetKind("PolicyReport")
+		obj.SetNamespace(namespace)
+		obj.SetName(policyReportName)
+		obj.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "kube-svc-watch"})
+		_, err = client.Create(ctx, obj, metav1.CreateOptions{FieldManager: *fieldManagerName})
+		return err
+	}
+	obj := old.DeepCopy()
+	obj.Object["results"] = content["results"]
+	obj.Object["summary"] = content["summary"]
+	_, err = client.Update(ctx, obj, metav1.UpdateOptions{FieldManager: *fieldManagerName})
+	return err
+}
+
+func (c *cluster) policyReportResult(svc *v1.Service) policyReportResult {
+	res := policyReportResult{
+		Source:   "kube-svc-watch",
+		Policy:   policyReportPolicy,
+		Category: policyReportCategory,
+		Scored:   true,
+		Resources: []v1.ObjectReference{{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Namespace:  svc.Namespace,
+			Name:       svc.Name,
+			UID:        svc.UID,
+		}},
+		Timestamp: policyReportTimestamp{Seconds: time.Now().Unix()},
+	}
+	reason := externalReason(svc)
+	switch {
+	case reason == "":
+		res.Rule = "internal-load-balancer"
+		res.Result = "pass"
+		res.Message = "LoadBalancer service is internal"
+	case exemptReason(svc) != "":
+		res.Rule = reason
+		res.Result = "skip"
+		res.Message = "LoadBalancer service is public, but exempt: " + exemptReason(svc)
+	default:
+		res.Rule = reason
+		res.Result = "fail"
+		res.Message = fmt.Sprintf("LoadBalancer service is public (%s)", reason)
+		res.Severity = policySeverity(c.severity(svc))
+	}
+	if reason != "" {
+		if controls := controlsFor(reason); len(controls) > 0 {
+			res.Properties = map[string]string{"controls": strings.Join(controls, ",")}
+		}
+	}
+	return res
+}
+
+// policySeverity maps our severity scores to PolicyReport severities.
+func policySeverity(score float64) string {
+	switch {
+	case score >= 10:
+		return "critical"
+	case score >= 6:
+		return "high"
+	case score >= 3:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+func policyResultKey(res policyReportResult) string {
+	return string(res.Resources[0].UID) + "/" + res.Rule + "/" + res.Result + "/" + res.Severity
+}
+
+func sortPolicyResults(results []policyReportResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Resources[0].Name < results[j].Resources[0].Name
+	})
+}
+
+// toUnstructuredMap converts v to the generic form of its JSON.
+func toUnstructuredMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	return ret, json.Unmarshal(b, &ret)
+}
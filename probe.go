@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Maximum number of connections a prober attempts at once.
+const probeConcurrency = 10
+
+var serviceReachable = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kube_svc_watch_service_reachable",
+		Help: "Whether any port of each public service's load balancer accepted a TCP connection (1) or not (0) at the last probe.",
+	},
+	[]string{"cluster", "namespace", "service"},
+)
+
+// prober periodically tries to connect to the load balancers of
+// public services, to tell exposures that are actually reachable
+// from those that only look public.
+type prober struct {
+	mu      sync.Mutex
+	results map[types.UID]probeResult
+}
+
+type probeResult struct {
+	reachable bool
+	// open is the first address that accepted a connection.
+	open string
+}
+
+func newProber() *prober {
+	return &prober{results: make(map[types.UID]probeResult)}
+}
+
+// lookup returns the last probe result for svc, if it has been probed.
+func (p *prober) lookup(svc *v1.Service) (probeResult, bool) {
+	if p == nil {
+		return probeResult{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.results[svc.UID]
+	return r, ok
+}
+
+// run probes c's public services every -probe-interval, until we
+// stop.
+func (p *prober) run(c *cluster) {
+	ticker := time.NewTicker(*probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.probeAll(c)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (p *prober) probeAll(c *cluster) {
+	var svcs []*v1.Service
+	for _, item := range c.store.List() {
+		svc := item.(*v1.Service)
+		if isExposed(svc) && len(svc.Status.LoadBalancer.Ingress) > 0 {
+			svcs = append(svcs, svc)
+		}
+	}
+
+	results := make(map[types.UID]probeResult, len(svcs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for _, svc := range svcs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(svc *v1.Service) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := probeService(svc)
+			mu.Lock()
+			results[svc.UID] = r
+			mu.Unlock()
+		}(svc)
+	}
+	wg.Wait()
+
+	serviceReachable.DeletePartialMatch(prometheus.Labels{"cluster": c.name})
+	for _, svc := range svcs {
+		r := results[svc.UID]
+		v := 0.0
+		if r.reachable {
+			v = 1
+		}
+		serviceReachable.WithLabelValues(c.name, svc.Namespace, svc.Name).Set(v)
+		logDebug("Probed service", "namespace", svc.Namespace, "service", svc.Name, "reachable", r.reachable, "address", r.open)
+	}
+
+	p.mu.Lock()
+	p.results = results
+	p.mu.Unlock()
+}
+
+// probeService tries each TCP port of each load balancer address of
+// svc, stopping at the first that accepts a connection.
+func probeService(svc *v1.Service) probeResult {
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		host := ingress.IP
+		if host == "" {
+			host = ingress.Hostname
+		}
+		if host == "" {
+			continue
+		}
+		for _, port := range svc.Spec.Ports {
+			if port.Protocol != "" && port.Protocol != v1.ProtocolTCP {
+				continue
+			}
+			addr := net.JoinHostPort(host, strconv.Itoa(int(port.Port)))
+			if err := probe(addr); err == nil {
+				return probeResult{reachable: true, open: addr}
+			}
+		}
+	}
+	return probeResult{}
+}
+
+// probe connects to addr, through -probe-proxy if set, and hangs up.
+func probe(addr string) error {
+	if *probeProxy == "" {
+		conn, err := net.DialTimeout("tcp", addr, *probeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	proxy, err := url.Parse(*probeProxy)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", proxy.Host, *probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*probeTimeout))
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		req.SetBasicAuth(proxy.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT to %s: %s", addr, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pushgatewayPath returns the Pushgateway grouping key path for
+// job and cluster.  Values containing a slash must be base64
+// encoded.
+func pushgatewayPath(job, cluster string) string {
+	enc := func(v string) string {
+		if strings.Contains(v, "/") {
+			return base64.URLEncoding.EncodeToString([]byte(v)) + "@base64"
+		}
+		return v
+	}
+	return fmt.Sprintf("/metrics/job/%s/cluster/%s", enc(job), enc(cluster))
+}
+
+// runPushgateway periodically replaces this cluster's metrics in a
+// Prometheus Pushgateway with the current registry contents.
+func runPushgateway(gateway, job string, interval time.Duration, gatherer prometheus.Gatherer) {
+	url := strings.TrimSuffix(gateway, "/") + pushgatewayPath(job, *clusterName)
+	for range time.Tick(interval) {
+		if err := pushMetrics(url, gatherer); err != nil {
+			logError("Error pushing metrics", "backend", "pushgateway", "endpoint", gateway, "error", err)
+		}
+	}
+}
+
+func pushMetrics(url string, gatherer prometheus.Gatherer) error {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, format)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("PUT", url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(format))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
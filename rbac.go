@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// canI asks the apiserver whether client may perform verb on services
+// in namespace ("" for all namespaces).
+func canI(client kubernetes.Interface, verb, namespace string) (bool, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	review := &authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Resource:  "services",
+			},
+		},
+	}
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// setEnforcement turns deleting services on or off to match
+// terminate, if we're allowed to.
+func (c *cluster) setEnforcement(terminate bool) error {
+	enforce, err := c.checkAccess(terminate)
+	if err != nil {
+		return err
+	}
+	if terminate && !enforce {
+		logWarn("Not allowed to delete services, only monitoring", "cluster", c.name)
+	}
+	if enforce && !c.readOnly.Load() {
+		metrics.EnforcementActive.WithLabelValues(c.name).Set(1)
+	} else {
+		metrics.EnforcementActive.WithLabelValues(c.name).Set(0)
+	}
+	c.enforce.Store(enforce)
+	return nil
+}
+
+// checkAccess makes sure we can get, list and watch services, so that a
+// missing permission fails at startup rather than as endless watch
+// errors.  If terminate, it also checks that we can annotate and delete
+// them, and returns whether we can.  Deletes are checked as -as, if set.
+func (c *cluster) checkAccess(terminate bool) (bool, error) {
+	nss := []string(namespaces)
+	if len(nss) == 0 {
+		nss = []string{metav1.NamespaceAll}
+	}
+	check := func(client kubernetes.Interface, verb string) (bool, error) {
+		for _, ns := range nss {
+			allowed, reason, err := canI(client, verb, ns)
+			if err != nil {
+				return false, fmt.Errorf("checking %s access to services: %v", verb, err)
+			}
+			if !allowed {
+				logError("Access denied", "cluster", c.name, "verb", verb, "resource", "services", "namespace", ns, "reason", reason)
+				metrics.AccessAllowed.WithLabelValues(c.name, verb).Set(0)
+				return false, nil
+			}
+		}
+		metrics.AccessAllowed.WithLabelValues(c.name, verb).Set(1)
+		return true, nil
+	}
+
+	for _, verb := range []string{"get", "list", "watch"} {
+		allowed, err := check(c.client, verb)
+		if err != nil {
+			return false, err
+		}
+		if !allowed {
+			return false, fmt.Errorf("cluster %s: not allowed to %s services", c.name, verb)
+		}
+	}
+	if !terminate {
+		return false, nil
+	}
+	// Services are annotated before they're deleted.
+	for _, verb := range []string{"update", "patch", "delete"} {
+		allowed, err := check(c.deleter, verb)
+		if !allowed || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
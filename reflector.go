@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerFor returns factory's shared informer for resource in
+// namespace (or all namespaces), with its health reported under the
+// cluster, resource and namespace name.  tweak, if not nil, may modify the
+// list and watch requests.  keep, if not nil, filters the objects
+// received.  The reflector asks for watch bookmarks, so a dropped
+// watch resumes from a recent resourceVersion rather than relisting.
+func (c *cluster) informerFor(factory informers.SharedInformerFactory, namespace, resource string, objType runtime.Object, tweak func(*metav1.ListOptions), keep func(metav1.Object) bool) cache.SharedIndexInformer {
+	name := resource
+	if namespace != metav1.NamespaceAll {
+		name += "/" + namespace
+	}
+	return factory.InformerFor(objType, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		health.register(c.name + "/" + name)
+		if tweak == nil {
+			tweak = func(*metav1.ListOptions) {}
+		}
+		var lw cache.ListerWatcher = instrumentedLW{
+			cache.NewFilteredListWatchFromClient(client.CoreV1().RESTClient(), resource, namespace, tweak),
+			c.name,
+			name,
+		}
+		if keep != nil {
+			lw = filteredLW{lw, keep}
+		}
+		if *listPageSize > 0 {
+			lw = pagedLW{lw, *listPageSize}
+		}
+		informer := cache.NewSharedIndexInformer(lw, objType, resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		informer.SetTransform(shrinkObject)
+		return informer
+	})
+}
+
+// lastAppliedAnnotation holds kubectl apply's copy of the whole
+// object, which we never look at.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// shrinkObject drops the parts of objects we don't use before they're
+// cached, since the cache holds every service (and node, and
+// namespace) in the cluster.  Objects are only ever written back after
+// a fresh Get, so this can't lose data.
+func shrinkObject(obj interface{}) (interface{}, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		// Eg a DeletedFinalStateUnknown.
+		return obj, nil
+	}
+	if _, ok := m.GetAnnotations()[lastAppliedAnnotation]; ok {
+		annotations := m.GetAnnotations()
+		delete(annotations, lastAppliedAnnotation)
+		m.SetAnnotations(annotations)
+	}
+	switch o := obj.(type) {
+	case *v1.Service:
+		// Keep just enough for fieldManager.
+		var managed []metav1.ManagedFieldsEntry
+		if manager := fieldManager(o); manager != "" {
+			managed = []metav1.ManagedFieldsEntry{{
+				Manager:    manager,
+				FieldsType: "FieldsV1",
+				FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:type":{}}}`)},
+			}}
+		}
+		o.ManagedFields = managed
+		o.Status.Conditions = nil
+	case *v1.Node:
+		o.ManagedFields = nil
+		o.Status = v1.NodeStatus{Addresses: o.Status.Addresses}
+	case *v1.Endpoints:
+		// Keep just enough to tell whether there are any
+		// ready endpoints.
+		o.ManagedFields = nil
+		var subsets []v1.EndpointSubset
+		for _, subset := range o.Subsets {
+			if len(subset.Addresses) > 0 {
+				subsets = []v1.EndpointSubset{{Addresses: subset.Addresses[:1]}}
+				break
+			}
+		}
+		o.Subsets = subsets
+	default:
+		m.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// selectServices returns a tweak applying -field-selector and
+// -label-selector to the Services watch.
+func selectServices() (func(*metav1.ListOptions), error) {
+	fieldSel, err := fields.ParseSelector(*fieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("bad -field-selector: %s", err)
+	}
+	labelSel, err := labels.Parse(*labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("bad -label-selector: %s", err)
+	}
+	return func(options *metav1.ListOptions) {
+		options.FieldSelector = fieldSel.String()
+		options.LabelSelector = labelSel.String()
+	}, nil
+}
+
+// shardFilter returns a filter for the objects in this replica's
+// shard, or nil if we aren't sharded.  Namespaces are assigned to
+// shards by hash, so a namespace's services are all handled by the
+// same replica.
+func shardFilter() (func(metav1.Object) bool, error) {
+	if *shardCount <= 1 {
+		return nil, nil
+	}
+	if *shardIndex < 0 || *shardIndex >= *shardCount {
+		return nil, fmt.Errorf("-shard-index must be from 0 to %d", *shardCount-1)
+	}
+	return func(obj metav1.Object) bool {
+		return shardOf(obj.GetNamespace(), *shardCount) == *shardIndex
+	}, nil
+}
+
+func shardOf(namespace string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// multiStore presents the stores of several informers as one
+// read-only store.
+type multiStore []cache.Store
+
+var errReadOnly = errors.New("store is read-only")
+
+func (m multiStore) Add(obj interface{}) error               { return errReadOnly }
+func (m multiStore) Update(obj interface{}) error            { return errReadOnly }
+func (m multiStore) Delete(obj interface{}) error            { return errReadOnly }
+func (m multiStore) Replace(_ []interface{}, _ string) error { return errReadOnly }
+func (m multiStore) Resync() error                           { return nil }
+
+func (m multiStore) List() []interface{} {
+	var ret []interface{}
+	for _, s := range m {
+		ret = append(ret, s.List()...)
+	}
+	return ret
+}
+
+func (m multiStore) ListKeys() []string {
+	var ret []string
+	for _, s := range m {
+		ret = append(ret, s.ListKeys()...)
+	}
+	return ret
+}
+
+func (m multiStore) Get(obj interface{}) (interface{}, bool, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return m.GetByKey(key)
+}
+
+func (m multiStore) GetByKey(key string) (interface{}, bool, error) {
+	for _, s := range m {
+		if item, exists, err := s.GetByKey(key); err != nil || exists {
+			return item, exists, err
+		}
+	}
+	return nil, false, nil
+}
+
+// instrumentedLW records the health of the wrapped ListerWatcher, so
+// a watch that has silently stopped is visible in metrics.
+type instrumentedLW struct {
+	cache.ListerWatcher
+	cluster string
+	name    string
+}
+
+func (lw instrumentedLW) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		metrics.WatchErrorsTotal.WithLabelValues(lw.cluster, lw.name).Inc()
+		return obj, err
+	}
+	metrics.LastSync.WithLabelValues(lw.cluster, lw.name).Set(float64(time.Now().Unix()))
+	health.listed(lw.cluster + "/" + lw.name)
+	if list, err := meta.ListAccessor(obj); err == nil {
+		if rv, err := strconv.ParseFloat(list.GetResourceVersion(), 64); err == nil {
+			metrics.LastListRV.WithLabelValues(lw.cluster, lw.name).Set(rv)
+		}
+	}
+	return obj, nil
+}
+
+func (lw instrumentedLW) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		metrics.WatchErrorsTotal.WithLabelValues(lw.cluster, lw.name).Inc()
+		return w, err
+	}
+	metrics.LastSync.WithLabelValues(lw.cluster, lw.name).Set(float64(time.Now().Unix()))
+	health.watching(lw.cluster+"/"+lw.name, true)
+	return newInstrumentedWatch(w, lw.cluster, lw.name), nil
+}
+
+// filteredLW drops objects that keep rejects from lists and watches,
+// so they never reach the cache.
+type filteredLW struct {
+	cache.ListerWatcher
+	keep func(metav1.Object) bool
+}
+
+func (lw filteredLW) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return obj, err
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	var kept []runtime.Object
+	for _, item := range items {
+		if m, err := meta.Accessor(item); err == nil && lw.keep(m) {
+			kept = append(kept, item)
+		}
+	}
+	if err := meta.SetList(obj, kept); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (lw filteredLW) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		return w, err
+	}
+	return watch.Filter(w, func(ev watch.Event) (watch.Event, bool) {
+		m, err := meta.Accessor(ev.Object)
+		if err != nil || ev.Type == watch.Bookmark {
+			return ev, true
+		}
+		return ev, lw.keep(m)
+	}), nil
+}
+
+// pagedLW lists in pages of limit objects.  Lists at resourceVersion
+// 0 are served whole from the apiserver's cache, ignoring the limit,
+// so they're made from etcd instead; the reflector follows the
+// continue tokens.  Unpaged lists, which the reflector falls back to
+// if a continue token expires, are left alone.
+type pagedLW struct {
+	cache.ListerWatcher
+	limit int64
+}
+
+func (lw pagedLW) List(options metav1.ListOptions) (runtime.Object, error) {
+	if options.Limit > 0 {
+		options.Limit = lw.limit
+		if options.ResourceVersion == "0" {
+			options.ResourceVersion = ""
+		}
+	}
+	return lw.ListerWatcher.List(options)
+}
+
+type instrumentedWatch struct {
+	watch.Interface
+	cluster  string
+	name     string
+	result   chan watch.Event
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newInstrumentedWatch(w watch.Interface, cluster, name string) *instrumentedWatch {
+	iw := &instrumentedWatch{
+		Interface: w,
+		cluster:   cluster,
+		name:      name,
+		result:    make(chan watch.Event),
+		stop:      make(chan struct{}),
+	}
+	go iw.relay()
+	return iw
+}
+
+func (w *instrumentedWatch) relay() {
+	defer close(w.result)
+	defer health.watching(w.cluster+"/"+w.name, false)
+	for ev := range w.Interface.ResultChan() {
+		if ev.Type == watch.Error {
+			metrics.WatchErrorsTotal.WithLabelValues(w.cluster, w.name).Inc()
+		} else {
+			metrics.LastSync.WithLabelValues(w.cluster, w.name).Set(float64(time.Now().Unix()))
+			health.watching(w.cluster+"/"+w.name, true)
+		}
+		select {
+		case w.result <- ev:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *instrumentedWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *instrumentedWatch) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	w.Interface.Stop()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// reportFormats are the formats writeReport supports.
+var reportFormats = map[string]func(io.Writer, []publicService) error{
+	"text":  textReport,
+	"json":  jsonReport,
+	"csv":   csvReport,
+	"html":  htmlReport,
+	"sarif": sarifReport,
+}
+
+// writeReport renders svcs in format.
+func writeReport(w io.Writer, format string, svcs []publicService) error {
+	f, ok := reportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	return f(w, svcs)
+}
+
+func textReport(w io.Writer, svcs []publicService) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tNAMESPACE\tNAME\tTYPE\tREASON\tEXEMPT\tSEVERITY\tCONTROLS")
+	for _, s := range svcs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%g\t%s\n", s.Cluster, s.Namespace, s.Name, s.Type, s.Reason, s.Exempt, s.Severity, strings.Join(s.Controls, ","))
+	}
+	return tw.Flush()
+}
+
+func jsonReport(w io.Writer, svcs []publicService) error {
+	if svcs == nil {
+		svcs = []publicService{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(svcs)
+}
+
+func csvReport(w io.Writer, svcs []publicService) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cluster", "namespace", "name", "uid", "type", "reason", "exempt", "severity", "created", "controls"})
+	for _, s := range svcs {
+		cw.Write([]string{
+			s.Cluster,
+			s.Namespace,
+			s.Name,
+			s.UID,
+			s.Type,
+			s.Reason,
+			s.Exempt,
+			strconv.FormatFloat(s.Severity, 'g', -1, 64),
+			s.Created.UTC().Format(time.RFC3339),
+			strings.Join(s.Controls, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Public services report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+tr.exempt { color: #888; }
+td.severity { text-align: right; }
+.summary { margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>Public services report</h1>
+<p class="summary">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.
+{{.Violations}} violations, {{.Exempt}} exempted.</p>
+{{if .Services}}
+<table>
+<tr><th>Cluster</th><th>Namespace</th><th>Name</th><th>Type</th><th>Reason</th><th>Exemption</th><th>Severity</th><th>Created</th><th>Controls</th></tr>
+{{range .Services}}
+<tr{{if .Exempt}} class="exempt"{{end}}><td>{{.Cluster}}</td><td>{{.Namespace}}</td><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Reason}}</td><td>{{.Exempt}}</td><td class="severity">{{if not .Exempt}}{{.Severity}}{{end}}</td><td>{{.Created.UTC.Format "2006-01-02 15:04:05"}}</td><td>{{range $i, $c := .Controls}}{{if $i}}, {{end}}{{$c}}{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No public services.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func htmlReport(w io.Writer, svcs []publicService) error {
+	data := struct {
+		Generated  time.Time
+		Services   []publicService
+		Violations int
+		Exempt     int
+	}{
+		Generated: time.Now().UTC(),
+		Services:  svcs,
+	}
+	for _, s := range svcs {
+		if s.Exempt == "" {
+			data.Violations++
+		} else {
+			data.Exempt++
+		}
+	}
+	return reportTemplate.Execute(w, data)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// handleRescan registers /admin/rescan, which re-evaluates every
+// service on POST, eg after changing policy or exemptions.
+func handleRescan(ls listeners, addr string) {
+	ls.handle(addr, "/admin/rescan", controlAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		logInfo("Rescanning services", "remote", r.RemoteAddr)
+		requeueClusters()
+		w.WriteHeader(http.StatusAccepted)
+	})))
+}
+
+// rescanCommand asks the instance serving the admin endpoints at the
+// URL given to re-evaluate every service, authenticating with
+// -admin-token-file.
+func rescanCommand(configPath string, args []string) int {
+	if err := loadConfig(flag.CommandLine, configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s rescan [flags] http(s)://admin-listen-address\n", os.Args[0])
+		return 2
+	}
+	token, err := readTokenFile(*adminTokenFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := setupHTTPClient(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(args[0], "/")+"/admin/rescan", nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	fmt.Println("Rescan started")
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/anguslees/kube-svc-watch/pkg/detect"
+)
+
+// SARIF 2.1.0, as accepted by GitHub code scanning and most security
+// dashboards.  Only the parts we need are modelled.
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	ShortDescription sarifText              `json:"shortDescription"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID       string                 `json:"ruleId"`
+	Level        string                 `json:"level"`
+	Message      sarifText              `json:"message"`
+	Locations    []sarifLocation        `json:"locations"`
+	Suppressions []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties   map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification"`
+}
+
+// sarifRules describes each reason a service can be public.
+// security-severity is GitHub's 0-10 scale.
+var sarifRules = []sarifRule{
+	{
+		ID:               detect.ReasonMissingAnnotation,
+		ShortDescription: sarifText{"LoadBalancer service has no internal load balancer annotation"},
+		Properties:       map[string]interface{}{"security-severity": "8.0"},
+	},
+	{
+		ID:               detect.ReasonWrongAnnotation,
+		ShortDescription: sarifText{"LoadBalancer service has an unrecognised internal load balancer annotation"},
+		Properties:       map[string]interface{}{"security-severity": "8.0"},
+	},
+	{
+		ID:               detect.ReasonOpenSourceRanges,
+		ShortDescription: sarifText{"LoadBalancer service allows any source address"},
+		Properties:       map[string]interface{}{"security-severity": "9.0"},
+	},
+	{
+		ID:               detect.ReasonRestrictedSourceRanges,
+		ShortDescription: sarifText{"LoadBalancer service is public, but restricted to some source ranges"},
+		Properties:       map[string]interface{}{"security-severity": "5.0"},
+	},
+	{
+		ID:               detect.ReasonNotApproved,
+		ShortDescription: sarifText{"LoadBalancer service is internal, but not approved"},
+		Properties:       map[string]interface{}{"security-severity": "3.0"},
+	},
+}
+
+// sarifRulesWithControls returns sarifRules tagged with their
+// compliance controls, which code scanning shows as tags.
+func sarifRulesWithControls() []sarifRule {
+	rules := make([]sarifRule, len(sarifRules))
+	for i, r := range sarifRules {
+		props := make(map[string]interface{}, len(r.Properties)+1)
+		for k, v := range r.Properties {
+			props[k] = v
+		}
+		if controls := controlsFor(r.ID); len(controls) > 0 {
+			props["tags"] = controls
+		}
+		r.Properties = props
+		rules[i] = r
+	}
+	return rules
+}
+
+func sarifReport(w io.Writer, svcs []publicService) error {
+	results := []sarifResult{}
+	for _, s := range svcs {
+		r := sarifResult{
+			RuleID: s.Reason,
+			Level:  "error",
+			Message: sarifText{
+				fmt.Sprintf("Service %s/%s in cluster %s is exposed by a public %s (%s)", s.Namespace, s.Name, s.Cluster, s.Type, s.Reason),
+			},
+			Properties: map[string]interface{}{
+				"cluster":  s.Cluster,
+				"severity": s.Severity,
+			},
+		}
+		if len(s.Controls) > 0 {
+			r.Properties["controls"] = s.Controls
+		}
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = fmt.Sprintf("%s/%s/services/%s", s.Cluster, s.Namespace, s.Name)
+		loc.LogicalLocations = []sarifLogicalLocation{{
+			FullyQualifiedName: s.Namespace + "/" + s.Name,
+			Kind:               "resource",
+		}}
+		r.Locations = []sarifLocation{loc}
+		if s.Exempt != "" {
+			r.Level = "note"
+			r.Suppressions = []sarifSuppression{{Kind: "external", Justification: s.Exempt}}
+		}
+		results = append(results, r)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "kube-svc-watch",
+				InformationURI: "https://github.com/anguslees/kube-svc-watch",
+				Rules:          sarifRulesWithControls(),
+			}},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
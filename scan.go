@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/pager"
+)
+
+// listCluster lists the cluster's services (and namespaces, if
+// needed for owner lookups) once, rather than watching them.
+func listCluster(name string, config *rest.Config) (*cluster, error) {
+	config.QPS = float32(*apiQPS)
+	config.Burst = *apiBurst
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := selectServices()
+	if err != nil {
+		return nil, err
+	}
+	opts := metav1.ListOptions{}
+	selector(&opts)
+	shard, err := shardFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+
+	c := &cluster{
+		name:   name,
+		client: clientset,
+		store:  cache.NewStore(cache.MetaNamespaceKeyFunc),
+	}
+	nss := namespaces
+	if len(nss) == 0 {
+		nss = []string{metav1.NamespaceAll}
+	}
+	for _, ns := range nss {
+		services := clientset.CoreV1().Services(ns)
+		p := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return services.List(ctx, opts)
+		})
+		p.PageSize = *listPageSize
+		err := p.EachListItem(ctx, opts, func(obj runtime.Object) error {
+			svc := obj.(*v1.Service)
+			if shard == nil || shard(svc) {
+				c.store.Add(svc)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg().usesNamespaces() {
+		list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		c.nsStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+		for i := range list.Items {
+			c.nsStore.Add(&list.Items[i])
+		}
+	}
+	return c, nil
+}
+
+// scan lists and classifies the services in each cluster once, and
+// prints the public ones.  Like grep, it exits 1 if there are any
+// violations, and 2 on error.
+func scan(configPath string, _ []string) int {
+	if err := loadConfig(flag.CommandLine, configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := applySettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	configs, err := clusterConfigs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var clusters []*cluster
+	for name, config := range configs {
+		c, err := listCluster(name, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return 2
+		}
+		clusters = append(clusters, c)
+	}
+
+	svcs := publicServices(clusters)
+	if err := saveReport(*reportFile, *reportFormat, svcs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	violations := 0
+	for _, s := range svcs {
+		if s.Exempt == "" {
+			violations++
+		}
+	}
+	if violations > 0 {
+		fmt.Fprintf(os.Stderr, "%d public services without an exemption\n", violations)
+		return 1
+	}
+	return 0
+}
+
+// saveReport writes the report to path, or stdout if path is "".
+func saveReport(path, format string, svcs []publicService) error {
+	if path == "" {
+		return writeReport(os.Stdout, format, svcs)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeReport(f, format, svcs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readServices returns the Services in the YAML or JSON manifests
+// in path.  Other kinds are ignored.
+func readServices(path string) ([]*v1.Service, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []*v1.Service
+	dec := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		svc := &v1.Service{}
+		err := dec.Decode(svc)
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if svc.Kind != "Service" {
+			continue
+		}
+		if svc.Namespace == "" {
+			svc.Namespace = metav1.NamespaceDefault
+		}
+		ret = append(ret, svc)
+	}
+}
+
+// validatePolicy checks the configuration, then shows how the
+// Services in the manifests named by args would be treated.  It
+// fails if the configuration is invalid.
+func validatePolicy(configPath string, args []string) int {
+	if err := loadConfig(flag.CommandLine, configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := applySettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := selectServices(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, ok := reportFormats[*reportFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown report format %q\n", *reportFormat)
+		return 1
+	}
+	if configPath != "" {
+		fmt.Printf("%s: OK\n", configPath)
+	}
+
+	c := &cluster{name: *clusterName}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tNAMESPACE\tNAME\tRESULT\tREASON\tSEVERITY")
+	for _, path := range args {
+		svcs, err := readServices(path)
+		if err != nil {
+			w.Flush()
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, svc := range svcs {
+			result := "internal"
+			if !isInternal(svc) {
+				result = "violation"
+				if exemptReason(svc) != "" {
+					result = "exempt"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%g\n", path, svc.Namespace, svc.Name, result, externalReason(svc), c.severity(svc))
+		}
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// readTokenFile reads a bearer token from path, or returns "" if path
+// is empty.
+func readTokenFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(buf))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// authenticated wraps h to require either the bearer token or a
+// verified client certificate, whichever are configured.  Health
+// checks are deliberately left unwrapped.
+func authenticated(h http.Handler) http.Handler {
+	return authenticate(h, true)
+}
+
+// strictlyAuthenticated is authenticated, but refuses everyone if
+// neither is configured, for endpoints that mustn't ever be open.
+func strictlyAuthenticated(h http.Handler) http.Handler {
+	return authenticate(h, false)
+}
+
+func authenticate(h http.Handler, openIfUnconfigured bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := cfg().authToken
+		if token == "" && *tlsClientCAFile == "" && openIfUnconfigured {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if *tlsClientCAFile != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if token != "" {
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) == 1 {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-svc-watch"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// clientCertConfig returns a TLS config that verifies client
+// certificates against the CAs in caFile.  Certificates are optional
+// at the TLS layer so that unauthenticated endpoints still work.
+func clientCertConfig(caFile string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  pool,
+	}, nil
+}
+
+func newServer(addr string, handler http.Handler, useTLS bool) (*http.Server, error) {
+	// Timeouts, so slow clients can't hold connections open.
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: *httpReadHeaderTimeout,
+		ReadTimeout:       *httpReadTimeout,
+		WriteTimeout:      *httpWriteTimeout,
+		IdleTimeout:       *httpIdleTimeout,
+		MaxHeaderBytes:    *httpMaxHeaderBytes,
+	}
+	if *disableHTTP2 {
+		// A non-nil empty map turns off HTTP/2.
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	if *tlsClientCAFile != "" && useTLS {
+		config, err := clientCertConfig(*tlsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = config
+	}
+	return srv, nil
+}
+
+// listen opens a listener on each of the comma-separated addresses in
+// addrs: host:port, or unix:///path for a Unix socket.  IPv4 and IPv6
+// addresses (eg 0.0.0.0:8080,[::]:8080) are bound separately, while an
+// empty host binds both at once.
+func listen(addrs string) ([]net.Listener, error) {
+	var ret []net.Listener
+	for _, addr := range splitList(addrs) {
+		l, err := listenOn(addr)
+		if err != nil {
+			for _, l := range ret {
+				l.Close()
+			}
+			return nil, err
+		}
+		ret = append(ret, l)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no listen address in %q", addrs)
+	}
+	return ret, nil
+}
+
+func listenOn(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix://"); path != addr {
+		// Remove a socket left behind by an unclean exit.
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	network := "tcp"
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			if ip.To4() != nil {
+				network = "tcp4"
+			} else {
+				network = "tcp6"
+			}
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// useTLS reports whether the named listener serves HTTPS.
+func useTLS(name string) bool {
+	if *tlsCertFile == "" {
+		return false
+	}
+	for _, l := range splitList(*tlsListeners) {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTLSListeners checks the names in -tls-listeners, and that
+// clients of every authenticated listener can authenticate.
+func checkTLSListeners() error {
+	if *tlsClientCAFile != "" && *tlsCertFile == "" {
+		return fmt.Errorf("-tls-client-ca-file requires -tls-cert-file")
+	}
+	for _, l := range splitList(*tlsListeners) {
+		switch l {
+		case "listen", "health", "admin", "webhook", "grpc":
+		default:
+			return fmt.Errorf("unknown listener %q in -tls-listeners", l)
+		}
+	}
+	// Client certificates only work over HTTPS, so without a token
+	// a plain listener would refuse everyone.
+	if *tlsClientCAFile != "" && *authTokenFile == "" {
+		for name, inUse := range map[string]bool{
+			"listen": !*noMetrics,
+			"admin":  *adminAddr != "",
+			"grpc":   *grpcAddr != "",
+		} {
+			if inUse && !useTLS(name) {
+				return fmt.Errorf("-tls-client-ca-file without -auth-token-file requires %s in -tls-listeners", name)
+			}
+		}
+	}
+	return nil
+}
+
+func serveHTTP(srv *http.Server, l net.Listener, useTLS bool) error {
+	if useTLS {
+		return srv.ServeTLS(l, *tlsCertFile, *tlsKeyFile)
+	}
+	return srv.Serve(l)
+}
+
+// listeners maps listen addresses to their handlers.  Endpoints
+// configured with the same address share a server.
+type listeners map[string]*http.ServeMux
+
+func (l listeners) handle(addr, pattern string, h http.Handler) {
+	mux, ok := l[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		l[addr] = mux
+	}
+	mux.Handle(pattern, h)
+}
+
+// start runs a server for every address, serving HTTPS on those in
+// tlsAddrs.  Any that fail send their error to the returned channel.
+func (l listeners) start(tlsAddrs map[string]bool) ([]*http.Server, <-chan error, error) {
+	var servers []*http.Server
+	errs := make(chan error, len(l))
+	for addr, mux := range l {
+		useTLS := tlsAddrs[addr]
+		srv, err := newServer(addr, mux, useTLS)
+		if err != nil {
+			return nil, nil, err
+		}
+		lns, err := listen(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		logInfo("Serving", "address", addr)
+		for _, l := range lns {
+			go func(l net.Listener) {
+				if err := serveHTTP(srv, l, useTLS); err != http.ErrServerClosed {
+					errs <- err
+				}
+			}(l)
+		}
+		servers = append(servers, srv)
+	}
+	return servers, errs, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// severity scores how bad a violation is, or returns 0 if svc isn't
+// one, as policy.Policy.Severity does.  The score is scaled by the
+// namespace's tier weight, if any.
+func (c *cluster) severity(svc *v1.Service) float64 {
+	st := cfg()
+	weight := 1.0
+	tier := c.namespaceValue(svc.Namespace, st.tierKeys)
+	if w, ok := st.tierWeights[tier]; ok {
+		weight = w
+	}
+	return rules().Severity(svc, weight)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var (
+	// stopCh is closed when we start shutting down.
+	stopCh = make(chan struct{})
+	// abandonCh is closed if shutdown times out before the
+	// terminators have drained their queues.
+	abandonCh = make(chan struct{})
+
+	// inflight is held (shared) by each terminator while it
+	// processes a service.
+	inflight sync.RWMutex
+	// terminators counts the running terminator loops.
+	terminators sync.WaitGroup
+)
+
+// shutdown stops the reflectors, lets the terminators drain their
+// queues, delivers queued notifications and saves our state, and
+// finally stops the HTTP and gRPC servers.  It gives up after timeout.
+func shutdown(timeout time.Duration, notify *liveNotifiers, servers []*http.Server, gs *grpc.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		close(stopCh)
+
+		drained := make(chan struct{})
+		go func() {
+			terminators.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			logWarn("Timed out draining the terminator queues")
+			close(abandonCh)
+		}
+
+		inflight.Lock()
+		notify.close()
+		state.flush()
+
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				logError("Error shutting down HTTP server", "address", srv.Addr, "error", err)
+			}
+		}
+		if gs != nil {
+			stopped := make(chan struct{})
+			go func() {
+				gs.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				gs.Stop()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		logInfo("Shutdown complete")
+	case <-ctx.Done():
+		logWarn("Timed out waiting for shutdown", "timeout", timeout)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/anguslees/kube-svc-watch/pkg/notify"
+)
+
+// batchOptions are -export-batch-size, -export-flush-interval and
+// -export-max-retries.
+func batchOptions() notify.BatchOptions {
+	return notify.BatchOptions{
+		Size:     *exportBatchSize,
+		Interval: *exportFlushInterval,
+		Retries:  *exportMaxRetries,
+		Logger:   pkgLogger{},
+	}
+}
+
+func newBatcher(backend string, send func([]*event) error) *notify.Batcher {
+	return notify.NewBatcher(backend, send, batchOptions())
+}
+
+func postJSON(url, contentType string, body io.Reader, setHeaders func(*http.Request)) ([]byte, error) {
+	return notify.Post(httpClient, url, contentType, body, setHeaders)
+}
+
+// newSplunkHEC returns a notifier that sends events to a Splunk HTTP
+// Event Collector.
+func newSplunkHEC(baseURL, token string) notifier {
+	return notify.NewSplunkHEC(httpClient, baseURL, token, batchOptions())
+}
+
+// newElasticsearch returns a notifier that indexes events into an
+// Elasticsearch index using the bulk API.  Credentials may be
+// embedded in the URL.
+func newElasticsearch(baseURL, index string) notifier {
+	return notify.NewElasticsearch(httpClient, baseURL, index, batchOptions())
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"github.com/nlopes/slack"
+)
+
+// How long to remember that an email address has no Slack user.
+const slackUsersRefresh = 10 * time.Minute
+
+// How often to retry validating the Slack configuration until it
+// works.
+const slackValidateRetry = time.Minute
+
+type slackNotifier struct {
+	api     *slack.Client
+	token   string
+	channel string
+	stop    chan struct{}
+
+	mu          sync.Mutex
+	usersByMail map[string]slackUser
+	// channelID is channel's ID, once validated.
+	channelID string
+}
+
+// slackUser is a cached users.lookupByEmail result.
+type slackUser struct {
+	// id is the user's ID, or "" if there's no such user.
+	id      string
+	checked time.Time
+}
+
+func newSlackNotifier(token, channel string) *slackNotifier {
+	n := &slackNotifier{
+		api:     slack.New(token),
+		token:   token,
+		channel: channel,
+		stop:    make(chan struct{}),
+	}
+	go n.validate()
+	return n
+}
+
+func (n *slackNotifier) Close() {
+	close(n.stop)
+}
+
+// validate checks the token and resolves the channel to its ID,
+// keeping us unready until they work, so a misconfiguration is found
+// at startup rather than when there's first something to report.
+func (n *slackNotifier) validate() {
+	for {
+		id, err := n.resolveChannel()
+		select {
+		case <-n.stop:
+			return
+		default:
+		}
+		health.setFailing("slack", err)
+		if err == nil {
+			logInfo("Validated Slack configuration", "channel", n.channel, "channel_id", id)
+			return
+		}
+		logError("Slack notifications can't be delivered", "channel", n.channel, "error", err)
+		select {
+		case <-time.After(slackValidateRetry):
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+func (n *slackNotifier) resolveChannel() (string, error) {
+	id, err := resolveSlackChannel(n.api, n.token, n.channel)
+	if err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	n.channelID = id
+	n.mu.Unlock()
+	return id, nil
+}
+
+// resolveSlackChannel checks token, and returns the ID of channel, a
+// name or ID, which token's user must be a member of.
+func resolveSlackChannel(api *slack.Client, token, channel string) (string, error) {
+	auth, err := api.AuthTest()
+	if err != nil {
+		return "", fmt.Errorf("checking token: %v", err)
+	}
+
+	name := strings.TrimPrefix(channel, "#")
+	cursor := ""
+	for {
+		var resp struct {
+			OK       bool   `json:"ok"`
+			Error    string `json:"error"`
+			Channels []struct {
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				IsMember bool   `json:"is_member"`
+			} `json:"channels"`
+			Metadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		form := url.Values{
+			"token":            {token},
+			"types":            {"public_channel,private_channel"},
+			"exclude_archived": {"true"},
+			"limit":            {"1000"},
+			"cursor":           {cursor},
+		}
+		body, err := postJSON(slack.SLACK_API+"conversations.list", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil)
+		if err != nil {
+			return "", fmt.Errorf("listing channels: %v", err)
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return "", fmt.Errorf("listing channels: %v", err)
+		}
+		if !resp.OK {
+			return "", fmt.Errorf("listing channels: %s", resp.Error)
+		}
+		for _, ch := range resp.Channels {
+			if ch.Name != name && ch.ID != name {
+				continue
+			}
+			if !ch.IsMember {
+				return "", fmt.Errorf("%s (%s) is not a member of channel %s", auth.User, auth.UserID, channel)
+			}
+			return ch.ID, nil
+		}
+		if resp.Metadata.NextCursor == "" {
+			return "", fmt.Errorf("channel %s not found, or not visible to %s (%s)", channel, auth.User, auth.UserID)
+		}
+		cursor = resp.Metadata.NextCursor
+	}
+}
+
+func (n *slackNotifier) Name() string {
+	return "slack"
+}
+
+// lookupUser returns the Slack user ID for email, or "" if unknown.
+func (n *slackNotifier) lookupUser(email string) (string, error) {
+	email = strings.ToLower(email)
+
+	// Not held across the lookup, so a slow Slack doesn't hold up
+	// other notifications.
+	n.mu.Lock()
+	u, ok := n.usersByMail[email]
+	n.mu.Unlock()
+	if ok && (u.id != "" || time.Since(u.checked) < slackUsersRefresh) {
+		return u.id, nil
+	}
+
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		User  struct {
+			ID      string `json:"id"`
+			Deleted bool   `json:"deleted"`
+		} `json:"user"`
+	}
+	form := url.Values{
+		"token": {n.token},
+		"email": {email},
+	}
+	body, err := postJSON(slack.SLACK_API+"users.lookupByEmail", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	if !resp.OK && resp.Error != "users_not_found" {
+		return "", fmt.Errorf("looking up user: %s", resp.Error)
+	}
+	u = slackUser{checked: time.Now()}
+	if resp.OK && !resp.User.Deleted {
+		u.id = resp.User.ID
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.usersByMail == nil {
+		n.usersByMail = make(map[string]slackUser)
+	}
+	n.usersByMail[email] = u
+	return u.id, nil
+}
+
+func (n *slackNotifier) Notify(ev *event) error {
+	var msg string
+	switch ev.Action {
+	case actionDetected:
+		switch {
+		case ev.Termination == nil:
+			msg = fmt.Sprintf("kube-svc-watch found public Service %s/%s/%s (%s). It won't be deleted, but please make it internal or get an exemption.", ev.Cluster, ev.Namespace, ev.Name, ev.Reason)
+		case ev.Termination.After(ev.Time):
+			msg = fmt.Sprintf("kube-svc-watch found public Service %s/%s/%s (%s). It will be deleted at %s unless it's made internal or exempted.", ev.Cluster, ev.Namespace, ev.Name, ev.Reason, ev.Termination.UTC().Format(time.RFC1123))
+		default:
+			// Being deleted now, which we'll report.
+			return nil
+		}
+	case actionDeleted:
+		msg = fmt.Sprintf("Cool story bro: kube-svc-watch just deleted a public Service (%s/%s/%s)! kthxbye.", ev.Cluster, ev.Namespace, ev.Name)
+	case actionDeleteFailed:
+		msg = fmt.Sprintf("kube-svc-watch gave up trying to delete public Service %s/%s/%s: %s", ev.Cluster, ev.Namespace, ev.Name, ev.Error)
+	case actionIdleDeleted:
+		msg = fmt.Sprintf("kube-svc-watch deleted public Service %s/%s/%s, which hadn't had any ready pods for over %s.", ev.Cluster, ev.Namespace, ev.Name, *idleDeleteAfter)
+	case actionLbPending:
+		msg = fmt.Sprintf("Service %s/%s/%s has been waiting for a load balancer for over %s. Check quotas and events.", ev.Cluster, ev.Namespace, ev.Name, *lbPendingAfter)
+	case actionEnforcementDisabled:
+		msg = fmt.Sprintf("kube-svc-watch is no longer allowed to delete Services in %s (%s), and is only monitoring until it is restarted with the necessary RBAC permissions.", ev.Cluster, ev.Error)
+	default:
+		return nil
+	}
+
+	if ev.Owner != "" {
+		msg += fmt.Sprintf(" (owner: %s)", ev.Owner)
+	}
+	if ev.ChangedBy != "" {
+		msg += fmt.Sprintf(" (last changed by %s)", ev.ChangedBy)
+	} else if ev.FieldManager != "" {
+		msg += fmt.Sprintf(" (last changed with %s)", ev.FieldManager)
+	}
+	if ev.Reachable != nil {
+		if *ev.Reachable {
+			msg += " (reachable from kube-svc-watch)"
+		} else {
+			msg += " (not reachable from kube-svc-watch)"
+		}
+	}
+	if len(ev.PublicHostnames) > 0 {
+		msg += fmt.Sprintf(" (published in public DNS as %s)", strings.Join(ev.PublicHostnames, ", "))
+	}
+	if len(ev.Changes) > 0 {
+		msg += "\nChanged: " + strings.Join(ev.Changes, "; ")
+	}
+	if ev.CreatorEmail != "" {
+		id, err := n.lookupUser(ev.CreatorEmail)
+		if err != nil {
+			logWarn("Error looking up slack user", "backend", n.Name(), "email", ev.CreatorEmail, "error", err)
+		}
+		if id != "" {
+			msg = fmt.Sprintf("<@%s> %s", id, msg)
+		}
+	}
+
+	// Once validated, post by ID, in case the channel is renamed.
+	n.mu.Lock()
+	channel := n.channelID
+	n.mu.Unlock()
+	if channel == "" {
+		channel = n.channel
+	}
+	channels := []string{channel}
+	if ev.OwnerSlackChannel != "" && ev.OwnerSlackChannel != n.channel {
+		channels = append(channels, ev.OwnerSlackChannel)
+	}
+	for _, channel := range channels {
+		chanId, timestamp, err := n.api.PostMessage(channel, msg, slack.PostMessageParameters{})
+		metrics.CountNotifications(n.Name(), 1, err)
+		if err != nil {
+			return err
+		}
+		logInfo("Sent notification", "backend", n.Name(), "action", ev.Action, "namespace", ev.Namespace, "service", ev.Name, "channel", channel, "channel_id", chanId, "ts", timestamp)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slack requests older than this are rejected, to prevent replays.
+const slackRequestMaxAge = 5 * time.Minute
+
+const slackCommandHelp = "Usage: `pause [duration]`, `resume`, `exempt namespace/name duration` or `status`."
+
+// slackCommandHandler serves a Slack slash command (eg /svc-watch) to
+// pause and resume enforcement, and temporarily exempt services.
+// Requests are verified with the app's signing secret, and only users
+// whose member IDs are in -slack-command-users may run commands.
+// Every command is logged.
+func slackCommandHandler(secret string, users []string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, u := range users {
+		allowed[u] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := verifySlackRequest(secret, r.Header, body); err != nil {
+			logWarn("Rejected Slack command", "remote", r.RemoteAddr, "error", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, userName := form.Get("user_id"), form.Get("user_name")
+		text := strings.TrimSpace(form.Get("text"))
+		// user_name is deprecated, and users can change it, so only
+		// their ID is trusted.
+		by := "slack:" + userID
+
+		var reply string
+		if !allowed[userID] {
+			logWarn("Slack command denied", "user", userName, "user_id", userID, "command", text)
+			reply = "Sorry, you're not allowed to control kube-svc-watch."
+		} else {
+			logInfo("Slack command", "user", userName, "user_id", userID, "command", text)
+			reply = runSlackCommand(strings.Fields(text), by)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"response_type": "in_channel",
+			"text":          reply,
+		})
+	})
+}
+
+func runSlackCommand(args []string, by string) string {
+	if len(args) == 0 {
+		return slackCommandHelp
+	}
+	switch args[0] {
+	case "pause":
+		var d time.Duration
+		if len(args) > 1 {
+			var err error
+			if d, err = time.ParseDuration(args[1]); err != nil || d <= 0 {
+				return fmt.Sprintf("Invalid duration %q.", args[1])
+			}
+		}
+		pause.set(d, by)
+		if d == 0 {
+			return "Enforcement paused until resumed."
+		}
+		return fmt.Sprintf("Enforcement paused for %s.", d)
+	case "resume":
+		pause.resume(by)
+		return "Enforcement resumed."
+	case "exempt":
+		if len(args) != 3 || strings.Count(args[1], "/") != 1 {
+			return slackCommandHelp
+		}
+		d, err := time.ParseDuration(args[2])
+		if err != nil || d <= 0 {
+			return fmt.Sprintf("Invalid duration %q.", args[2])
+		}
+		snoozes.add(args[1], d, by)
+		return fmt.Sprintf("%s is exempt for %s.", args[1], d)
+	case "status":
+		if until := pause.pausedUntil(); !until.IsZero() {
+			if until.Sub(time.Now()) > forever/2 {
+				return "Enforcement is paused until resumed."
+			}
+			return fmt.Sprintf("Enforcement is paused until %s.", until.UTC().Format(time.RFC3339))
+		}
+		return "Enforcement is active."
+	default:
+		return slackCommandHelp
+	}
+}
+
+// verifySlackRequest checks a request's signature, as described at
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackRequest(secret string, header http.Header, body []byte) error {
+	ts := header.Get("X-Slack-Request-Timestamp")
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp %q", ts)
+	}
+	if age := time.Since(time.Unix(secs, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return fmt.Errorf("stale request from %s", time.Unix(secs, 0).UTC())
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("bad signature")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// snoozeReason is the exemption reason for snoozed services.
+const snoozeReason = "snoozed"
+
+// snoozes are temporary exemptions for services, by namespace/name in
+// any cluster.  They are saved to the state store.
+var snoozes = &snoozeList{until: make(map[string]time.Time)}
+
+type snoozeList struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// restore loads the snoozes saved before we restarted.
+func (s *snoozeList) restore() error {
+	until := make(map[string]time.Time)
+	if err := state.get("snoozes", &until); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range until {
+		if d := time.Until(t); d > 0 {
+			s.until[key] = t
+			time.AfterFunc(d, func() { s.expire(key) })
+		}
+	}
+	return nil
+}
+
+// add exempts the service namespace/name for d.  by says who asked,
+// for the log.
+func (s *snoozeList) add(key string, d time.Duration, by string) {
+	t := time.Now().Add(d).UTC()
+	s.mu.Lock()
+	s.until[key] = t
+	state.set("snoozes", s.until)
+	s.mu.Unlock()
+	logWarn("Service snoozed", "service", key, "by", by, "until", t.Format(time.RFC3339))
+	time.AfterFunc(d, func() { s.expire(key) })
+	requeueClusters()
+}
+
+func (s *snoozeList) expire(key string) {
+	s.mu.Lock()
+	t, ok := s.until[key]
+	if !ok || time.Now().Before(t) {
+		// Snoozed again in the meantime.
+		s.mu.Unlock()
+		return
+	}
+	delete(s.until, key)
+	state.set("snoozes", s.until)
+	s.mu.Unlock()
+	logInfo("Service snooze expired", "service", key)
+	requeueClusters()
+}
+
+// reason returns snoozeReason if svc is snoozed, or else "".
+func (s *snoozeList) reason(svc *v1.Service) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().Before(s.until[svcKey(svc)]) {
+		return snoozeReason
+	}
+	return ""
+}
+
+// expiringWithin returns the snoozes that expire within d, with when.
+func (s *snoozeList) expiringWithin(d time.Duration) map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make(map[string]time.Time)
+	now := time.Now()
+	for key, t := range s.until {
+		if t.After(now) && t.Sub(now) <= d {
+			ret[key] = t
+		}
+	}
+	return ret
+}
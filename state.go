@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// How often changed state is written back.
+const stateFlushInterval = 30 * time.Second
+
+// state is nil unless -state-configmap is set.
+var state *stateStore
+
+// stateKey makes a ConfigMap key from name, which may be a cluster or
+// context name.
+func stateKey(prefix, name string) string {
+	return prefix + "." + invalidStateKeyChars.ReplaceAllString(name, "_")
+}
+
+var invalidStateKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// stateStore keeps state that should survive restarts in a ConfigMap,
+// as a JSON document per key.  All methods are safe to call on a nil
+// store, which keeps nothing.
+type stateStore struct {
+	client    corev1.ConfigMapInterface
+	namespace string
+	name      string
+
+	mu    sync.Mutex
+	data  map[string]string
+	dirty bool
+}
+
+// newStateStore loads the ConfigMap named by ref, in the first cluster
+// we watch.  It is created when first flushed if it doesn't exist.
+func newStateStore(ref string, clusters []*cluster) (*stateStore, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("-state-configmap must be namespace/name, got %q", ref)
+	}
+	var c *cluster
+	for _, c = range clusters {
+		if c.name == primaryCluster() {
+			break
+		}
+	}
+	s := &stateStore{
+		client:    c.client.CoreV1().ConfigMaps(parts[0]),
+		namespace: parts[0],
+		name:      parts[1],
+		data:      make(map[string]string),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	cm, err := s.client.Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cm.Data {
+		s.data[k] = v
+	}
+	return s, nil
+}
+
+// get decodes the value saved under key into v.  It leaves v alone if
+// nothing was saved.
+func (s *stateStore) get(key string, v interface{}) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	data, ok := s.data[key]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// set saves v under key, to be written at the next flush.
+func (s *stateStore) set(key string, v interface{}) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		logError("Error encoding state", "key", key, "error", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data[key] != string(data) {
+		s.data[key] = string(data)
+		s.dirty = true
+	}
+}
+
+// run flushes changes periodically until we stop.  The final flush is
+// left to shutdown.
+func (s *stateStore) run() {
+	ticker := time.NewTicker(stateFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// flush writes the ConfigMap, if anything has changed.
+func (s *stateStore) flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	data := make(map[string]string, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *apiTimeout)
+	defer cancel()
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: s.namespace,
+			Name:      s.name,
+		},
+		Data: data,
+	}
+	// We're the only writer, so there's no need to merge.
+	_, err := s.client.Update(ctx, cm, metav1.UpdateOptions{FieldManager: *fieldManagerName})
+	if errors.IsNotFound(err) {
+		_, err = s.client.Create(ctx, cm, metav1.CreateOptions{FieldManager: *fieldManagerName})
+	}
+	if err != nil {
+		logError("Error saving state", "configmap", s.namespace+"/"+s.name, "error", err)
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Keep packets under a typical MTU.
+const statsdMaxPacket = 1432
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_")
+
+// runStatsd periodically sends our counters and gauges to a StatsD
+// server.  With dogstatsd, labels become tags; otherwise label
+// values are appended to the metric name.
+func runStatsd(addr, prefix string, dogstatsd bool, interval time.Duration, gatherer prometheus.Gatherer) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		logError("Error connecting", "backend", "statsd", "endpoint", addr, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// Counters are sent as deltas since the last interval.
+	last := make(map[string]float64)
+
+	for range time.Tick(interval) {
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			logError("Error gathering metrics", "backend", "statsd", "error", err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		for _, line := range statsdLines(mfs, prefix, dogstatsd, last) {
+			if buf.Len() > 0 && buf.Len()+len(line)+1 > statsdMaxPacket {
+				conn.Write(buf.Bytes())
+				buf.Reset()
+			}
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(line)
+		}
+		if buf.Len() > 0 {
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				logError("Error sending metrics", "backend", "statsd", "endpoint", addr, "error", err)
+			}
+		}
+	}
+}
+
+func statsdLines(mfs []*dto.MetricFamily, prefix string, dogstatsd bool, last map[string]float64) []string {
+	var lines []string
+	for _, mf := range mfs {
+		if !strings.HasPrefix(mf.GetName(), "kube_") {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			name := prefix + mf.GetName()
+			var tags []string
+			for _, l := range m.GetLabel() {
+				if dogstatsd {
+					tags = append(tags, statsdReplacer.Replace(l.GetName()+":"+l.GetValue()))
+				} else if l.GetValue() != "" {
+					name += "." + statsdReplacer.Replace(l.GetValue())
+				}
+			}
+			suffix := ""
+			if len(tags) > 0 {
+				suffix = "|#" + strings.Join(tags, ",")
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				key := name + suffix
+				v := m.GetCounter().GetValue()
+				delta := v - last[key]
+				last[key] = v
+				if delta > 0 {
+					lines = append(lines, fmt.Sprintf("%s:%g|c%s", name, delta, suffix))
+				}
+			case dto.MetricType_GAUGE:
+				lines = append(lines, fmt.Sprintf("%s:%g|g%s", name, m.GetGauge().GetValue(), suffix))
+			}
+		}
+	}
+	return lines
+}
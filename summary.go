@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"github.com/nlopes/slack"
+)
+
+// How often to check whether a summary is due.
+const summaryCheckInterval = time.Hour
+
+// Number of namespaces listed in a summary.
+const summaryTopNamespaces = 5
+
+// summary counts the events of the current -slack-summary-interval,
+// for the periodic summary.  It is saved to the state store, so a
+// restart doesn't lose the period.
+var summary = &summaryCounter{}
+
+type summaryCounter struct {
+	mu   sync.Mutex
+	data summaryData
+}
+
+type summaryData struct {
+	Since      time.Time `json:"since"`
+	LastPosted time.Time `json:"lastPosted"`
+	// Detected and Deleted hold the UIDs of services, by
+	// cluster/namespace, so re-notifications aren't counted
+	// twice.
+	Detected map[string]map[string]bool `json:"detected"`
+	Deleted  map[string]map[string]bool `json:"deleted"`
+}
+
+func (s *summaryCounter) Name() string {
+	return "summary"
+}
+
+func (s *summaryCounter) Notify(ev *event) error {
+	var counts *map[string]map[string]bool
+	switch ev.Action {
+	case actionDetected:
+		counts = &s.data.Detected
+	case actionDeleted, actionIdleDeleted:
+		counts = &s.data.Deleted
+	default:
+		return nil
+	}
+	key := ev.Cluster + "/" + ev.Namespace
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *counts == nil {
+		*counts = make(map[string]map[string]bool)
+	}
+	if (*counts)[key] == nil {
+		(*counts)[key] = make(map[string]bool)
+	}
+	(*counts)[key][ev.UID] = true
+	state.set("summary", s.data)
+	return nil
+}
+
+// restore loads the period saved before we restarted.
+func (s *summaryCounter) restore() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return state.get("summary", &s.data)
+}
+
+// run posts a summary to channel every interval, until we stop.
+func (s *summaryCounter) run(clusters []*cluster, channel string, interval time.Duration) {
+	s.mu.Lock()
+	if s.data.LastPosted.IsZero() {
+		s.data.Since = time.Now().UTC()
+		s.data.LastPosted = s.data.Since
+		state.set("summary", s.data)
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(summaryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+		s.mu.Lock()
+		due := time.Since(s.data.LastPosted) >= interval
+		s.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		// The token may have been changed by a reload.
+		api := slack.New(cfg().slackToken)
+		msg := s.format(clusters, interval)
+		_, _, err := api.PostMessage(channel, msg, slack.PostMessageParameters{})
+		metrics.CountNotifications(s.Name(), 1, err)
+		if err != nil {
+			logError("Error posting summary", "channel", channel, "error", err)
+			continue
+		}
+		logInfo("Posted summary", "channel", channel)
+
+		now := time.Now().UTC()
+		s.mu.Lock()
+		s.data = summaryData{Since: now, LastPosted: now}
+		state.set("summary", s.data)
+		s.mu.Unlock()
+	}
+}
+
+// format renders the summary of the current period as Slack markdown.
+func (s *summaryCounter) format(clusters []*cluster, interval time.Duration) string {
+	s.mu.Lock()
+	since := s.data.Since
+	detected := countUIDs(s.data.Detected)
+	deleted := countUIDs(s.data.Deleted)
+	s.mu.Unlock()
+
+	violations := make(map[string]int)
+	total, exempt := 0, 0
+	for _, svc := range publicServices(clusters) {
+		if svc.Exempt != "" {
+			exempt++
+			continue
+		}
+		total++
+		violations[svc.Cluster+"/"+svc.Namespace]++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*kube-svc-watch summary* (%s to %s)\n", since.Format("Jan 2"), time.Now().UTC().Format("Jan 2"))
+	fmt.Fprintf(&b, "• New public services: %d\n", sumCounts(detected))
+	fmt.Fprintf(&b, "• Deleted: %d\n", sumCounts(deleted))
+	fmt.Fprintf(&b, "• Public services now: %d, plus %d exempt\n", total, exempt)
+
+	expiring := snoozes.expiringWithin(interval)
+	if len(expiring) > 0 {
+		b.WriteString("\n*Snoozes expiring soon*\n")
+		for _, key := range sortedKeys(expiring) {
+			fmt.Fprintf(&b, "• %s, %s\n", key, expiring[key].Format("Mon Jan 2 15:04 MST"))
+		}
+	}
+
+	var duplicates []string
+	for _, c := range clusters {
+		for key, names := range duplicateLoadBalancers(c.store) {
+			duplicates = append(duplicates, fmt.Sprintf("`%s/%s`: %s (`%s`)", c.name, key.namespace, strings.Join(names, ", "), key.selector))
+		}
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		b.WriteString("\n*Duplicate load balancers*\n")
+		for i, d := range duplicates {
+			if i == summaryTopNamespaces {
+				fmt.Fprintf(&b, "• and %d more\n", len(duplicates)-i)
+				break
+			}
+			fmt.Fprintf(&b, "• %s\n", d)
+		}
+	}
+
+	if len(violations) > 0 || len(detected) > 0 {
+		b.WriteString("\n*Top namespaces* (public services now / new)\n")
+		type row struct {
+			ns       string
+			now, new int
+		}
+		var rows []row
+		for ns := range violations {
+			rows = append(rows, row{ns, violations[ns], detected[ns]})
+		}
+		for ns := range detected {
+			if _, ok := violations[ns]; !ok {
+				rows = append(rows, row{ns, 0, detected[ns]})
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].now+rows[i].new != rows[j].now+rows[j].new {
+				return rows[i].now+rows[i].new > rows[j].now+rows[j].new
+			}
+			return rows[i].ns < rows[j].ns
+		})
+		if len(rows) > summaryTopNamespaces {
+			rows = rows[:summaryTopNamespaces]
+		}
+		for i, r := range rows {
+			fmt.Fprintf(&b, "%d. `%s`: %d / %d\n", i+1, r.ns, r.now, r.new)
+		}
+	}
+	return b.String()
+}
+
+func countUIDs(m map[string]map[string]bool) map[string]int {
+	ret := make(map[string]int, len(m))
+	for k, uids := range m {
+		ret[k] = len(uids)
+	}
+	return ret
+}
+
+func sumCounts(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+func sortedKeys(m map[string]time.Time) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
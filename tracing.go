@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	statusCodeError = 2
+)
+
+// spans is where finished spans are queued for export.  Tracing is
+// disabled (and every span nil) while it is nil.
+var spans chan *span
+
+// span is a minimal OpenTelemetry span.  All methods are safe to
+// call on a nil span.
+type span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []string
+	err      error
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan starts a new span, as a child of parent if that isn't
+// nil.  kv are attribute key/value pairs.
+func startSpan(parent *span, name string, kind int, kv ...string) *span {
+	if spans == nil {
+		return nil
+	}
+	s := &span{
+		spanID: randomID(8),
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  kv,
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return s
+}
+
+func (s *span) setAttr(k, v string) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, k, v)
+}
+
+// finish ends the span, marking it failed if err is non-nil.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	select {
+	case spans <- s:
+	default:
+		// Tracing is best-effort; never block enforcement on it.
+	}
+}
+
+func (s *span) otlp() map[string]interface{} {
+	ret := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": otlpTime(s.start),
+		"endTimeUnixNano":   otlpTime(s.end),
+		"attributes":        otlpAttrs(s.attrs...),
+	}
+	if s.parentID != "" {
+		ret["parentSpanId"] = s.parentID
+	}
+	if s.err != nil {
+		ret["status"] = map[string]interface{}{
+			"code":    statusCodeError,
+			"message": s.err.Error(),
+		}
+	}
+	return ret
+}
+
+// runOTLPTraces enables tracing, and exports finished spans to an
+// OTLP collector in batches.
+func runOTLPTraces(endpoint string) {
+	spans = make(chan *span, 1000)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		var batch []interface{}
+		for {
+			select {
+			case s := <-spans:
+				batch = append(batch, s.otlp())
+				if len(batch) < 100 {
+					continue
+				}
+			case <-ticker.C:
+				if len(batch) == 0 {
+					continue
+				}
+			}
+			err := otlpPost(endpoint, "traces", map[string]interface{}{
+				"resourceSpans": []interface{}{
+					map[string]interface{}{
+						"resource": otlpResource(),
+						"scopeSpans": []interface{}{
+							map[string]interface{}{
+								"scope": map[string]string{"name": "kube-svc-watch"},
+								"spans": batch,
+							},
+						},
+					},
+				},
+			})
+			if err != nil {
+				logError("Error exporting spans", "backend", "otlp", "endpoint", endpoint, "spans", len(batch), "error", err)
+			}
+			batch = nil
+		}
+	}()
+}
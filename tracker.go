@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anguslees/kube-svc-watch/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	remediationDeleted  = "deleted"
+	remediationPatched  = "patched"
+	remediationExempted = "exempted"
+)
+
+type exposure struct {
+	uid   types.UID
+	since time.Time
+}
+
+// exposureTracker remembers when each public service was first
+// observed, so the exposure window can be recorded once it is
+// remediated.
+type exposureTracker struct {
+	cluster string
+	store   cache.Store
+
+	mu      sync.Mutex
+	exposed map[string]exposure
+}
+
+func newExposureTracker(c *cluster) *exposureTracker {
+	t := &exposureTracker{
+		cluster: c.name,
+		store:   c.store,
+		exposed: make(map[string]exposure),
+	}
+	go t.run()
+	return t
+}
+
+func svcKey(svc *v1.Service) string {
+	return svc.Namespace + "/" + svc.Name
+}
+
+// public records that svc was observed to be public.
+func (t *exposureTracker) public(svc *v1.Service) {
+	key := svcKey(svc)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.exposed[key]; !ok || e.uid != svc.UID {
+		t.exposed[key] = exposure{uid: svc.UID, since: time.Now()}
+	}
+}
+
+// since returns when svc was first observed to be public, which must
+// have been recorded.
+func (t *exposureTracker) since(svc *v1.Service) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exposed[svcKey(svc)].since
+}
+
+// remediated records that svc is no longer public, and how.
+func (t *exposureTracker) remediated(svc *v1.Service, how string) {
+	key := svcKey(svc)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.exposed[key]; ok && e.uid == svc.UID {
+		metrics.RemediationSeconds.WithLabelValues(t.cluster, how).Observe(time.Since(e.since).Seconds())
+		delete(t.exposed, key)
+	}
+}
+
+// run is a safety net for services whose deletion the terminator
+// didn't see, such as those replaced by a new incarnation between
+// watch events.
+func (t *exposureTracker) run() {
+	for range time.Tick(time.Minute) {
+		t.mu.Lock()
+		for key, e := range t.exposed {
+			obj, exists, err := t.store.GetByKey(key)
+			if err != nil {
+				continue
+			}
+			if !exists || obj.(*v1.Service).UID != e.uid {
+				metrics.RemediationSeconds.WithLabelValues(t.cluster, remediationDeleted).Observe(time.Since(e.since).Seconds())
+				delete(t.exposed, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// publicService is a service that isn't internal, exempt or not.
+type publicService struct {
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       string    `json:"uid"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Exempt    string    `json:"exempt,omitempty"`
+	Severity  float64   `json:"severity,omitempty"`
+	Created   time.Time `json:"created"`
+	Controls  []string  `json:"controls,omitempty"`
+}
+
+// publicServices lists the public services in every cluster, sorted
+// by cluster, namespace and name.
+func publicServices(clusters []*cluster) []publicService {
+	var ret []publicService
+	for _, c := range clusters {
+		for _, item := range c.store.List() {
+			svc := item.(*v1.Service)
+			if isInternal(svc) {
+				continue
+			}
+			ret = append(ret, publicService{
+				Cluster:   c.name,
+				Namespace: svc.Namespace,
+				Name:      svc.Name,
+				UID:       string(svc.UID),
+				Type:      string(svc.Spec.Type),
+				Reason:    externalReason(svc),
+				Exempt:    exemptReason(svc),
+				Severity:  c.severity(svc),
+				Created:   svc.CreationTimestamp.Time,
+				Controls:  controlsFor(externalReason(svc)),
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return ret
+}
+
+var uiTemplate = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>kube-svc-watch</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+tr.exempt { color: #888; }
+td.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>kube-svc-watch</h1>
+
+<h2>Public services</h2>
+{{if .Services}}
+<table>
+<tr><th>Cluster</th><th>Namespace</th><th>Name</th><th>Type</th><th>Reason</th><th>Exemption</th><th>Severity</th><th>Created</th></tr>
+{{range .Services}}
+<tr{{if .Exempt}} class="exempt"{{end}}><td>{{.Cluster}}</td><td>{{.Namespace}}</td><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Reason}}</td><td>{{.Exempt}}</td><td>{{if not .Exempt}}{{.Severity}}{{end}}</td><td>{{.Created.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>None.</p>
+{{end}}
+
+<h2>Recent actions</h2>
+{{if .Events}}
+<table>
+<tr><th>Time</th><th>Cluster</th><th>Action</th><th>Namespace</th><th>Name</th><th>Reason</th><th>Owner</th><th>Error</th></tr>
+{{range .Events}}
+<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td>{{.Cluster}}</td><td>{{.Action}}</td><td>{{.Namespace}}</td><td>{{.Name}}</td><td>{{.Reason}}</td><td>{{.Owner}}</td><td class="error">{{.Error}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>None since startup.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// uiHandler serves a page listing public services and recent
+// actions.
+func uiHandler(clusters []*cluster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		data := struct {
+			Services []publicService
+			Events   []*event
+		}{
+			Services: publicServices(clusters),
+			Events:   recent.list(),
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := uiTemplate.Execute(w, data); err != nil {
+			logError("Error rendering UI", "error", err)
+		}
+	})
+}
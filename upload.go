@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// File extensions of report formats, where they differ from the name.
+var reportExtensions = map[string]string{
+	"text": "txt",
+}
+
+// reportUploader periodically writes reports to an object store, as
+// audit evidence.
+type reportUploader struct {
+	store     objectStore
+	prefix    string
+	formats   []string
+	retention time.Duration
+}
+
+func newReportUploader(url string, formats []string, retention time.Duration) (*reportUploader, error) {
+	store, prefix, err := newObjectStore(url)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range formats {
+		if _, ok := reportFormats[f]; !ok {
+			return nil, fmt.Errorf("unknown report format %q", f)
+		}
+	}
+	return &reportUploader{store: store, prefix: prefix, formats: formats, retention: retention}, nil
+}
+
+// run uploads reports every interval, until we stop.
+func (u *reportUploader) run(clusters []*cluster, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+		if err := u.upload(clusters, time.Now().UTC()); err != nil {
+			logError("Error uploading report", "error", err)
+			continue
+		}
+		if u.retention > 0 {
+			if err := u.expire(time.Now().Add(-u.retention)); err != nil {
+				logError("Error expiring old reports", "error", err)
+			}
+		}
+	}
+}
+
+// upload writes a report in each format, named for now.
+func (u *reportUploader) upload(clusters []*cluster, now time.Time) error {
+	svcs := publicServices(clusters)
+	stamp := now.Format("2006-01-02T15-04-05Z")
+	for _, format := range u.formats {
+		var buf bytes.Buffer
+		if err := writeReport(&buf, format, svcs); err != nil {
+			return err
+		}
+		ext := reportExtensions[format]
+		if ext == "" {
+			ext = format
+		}
+		key := u.prefix + stamp + "." + ext
+		if err := u.store.put(key, reportContentTypes[format], buf.Bytes()); err != nil {
+			return fmt.Errorf("uploading %s: %v", key, err)
+		}
+		logInfo("Uploaded report", "key", key, "services", len(svcs))
+	}
+	return nil
+}
+
+// expire deletes our reports last modified before cutoff.  Only
+// objects directly under the prefix are considered.
+func (u *reportUploader) expire(cutoff time.Time) error {
+	objects, err := u.store.list(u.prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if strings.Contains(strings.TrimPrefix(obj.key, u.prefix), "/") || !obj.modified.Before(cutoff) {
+			continue
+		}
+		if err := u.store.delete(obj.key); err != nil {
+			return fmt.Errorf("deleting %s: %v", obj.key, err)
+		}
+		logInfo("Deleted expired report", "key", obj.key)
+	}
+	return nil
+}